@@ -0,0 +1,49 @@
+package cryptsetup
+
+import "github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+
+// Capabilities reports which features the loaded libcryptsetup supports.
+type Capabilities struct {
+	// Version is the minimal libcryptsetup version providing all exported symbols, e.g. "2.6".
+	// libcryptsetup does not export its version, so it is derived from the available symbols.
+	Version string
+	// Functions holds the availability of every bound libcryptsetup function by C name.
+	Functions map[string]bool
+
+	// TokenPIN reports whether ActivateByTokenPIN is supported.
+	TokenPIN bool
+	// TokenMax reports whether TokenMax is supported.
+	TokenMax bool
+	// ExternalTokens reports whether external token plugins can be controlled.
+	ExternalTokens bool
+	// KeyringLink reports whether SetKeyringToLink is supported.
+	KeyringLink bool
+	// SafeAlloc reports whether secrets are allocated by libcryptsetup's safe allocator.
+	// Otherwise, mlock-ed libc memory is used.
+	SafeAlloc bool
+}
+
+// Has reports whether the loaded libcryptsetup provides the C function.
+func (capabilities Capabilities) Has(functionName string) bool {
+	return capabilities.Functions[functionName]
+}
+
+// Capabilities reports the capabilities of the loaded libcryptsetup.
+func (library *Library) Capabilities() Capabilities {
+	functions := crypt.Symbols()
+	return Capabilities{
+		Version:        library.Version(),
+		Functions:      functions,
+		TokenPIN:       functions["crypt_activate_by_token_pin"],
+		TokenMax:       functions["crypt_token_max"],
+		ExternalTokens: functions["crypt_token_external_disable"] && functions["crypt_token_external_path"],
+		KeyringLink:    functions["crypt_set_keyring_to_link"],
+		SafeAlloc:      crypt.HasSafeAlloc(),
+	}
+}
+
+// Version returns the minimal libcryptsetup version providing all exported symbols, e.g. "2.6".
+// libcryptsetup does not export its version, so it is derived from the available symbols.
+func (library *Library) Version() string {
+	return crypt.Version()
+}
@@ -0,0 +1,41 @@
+package cryptsetup
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Library_Capabilities(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	library, err := Open(LibraryOptions{})
+	testWrapper.AssertNoError(err)
+
+	capabilities := library.Capabilities()
+	if capabilities.Version == "" {
+		test.Error("Expected a libcryptsetup version")
+	}
+	if !capabilities.Has("crypt_init") {
+		test.Error("Expected crypt_init to be available")
+	}
+	if capabilities.Has("crypt_nonexistent") {
+		test.Error("Expected unknown functions to be unavailable")
+	}
+	if capabilities.TokenMax != capabilities.Has("crypt_token_max") {
+		test.Error("Expected TokenMax to match the availability of crypt_token_max")
+	}
+}
+
+func Test_NotSupportedError(test *testing.T) {
+	err := error(&NotSupportedError{functionName: "crypt_nonexistent"})
+	if !errors.Is(err, ErrNotSupported) {
+		test.Error("Expected NotSupportedError to match ErrNotSupported")
+	}
+
+	testWrapper := TestWrapper{test}
+	testWrapper.AssertNoError(ensureIntialized())
+	if err := supported("crypt_nonexistent"); !errors.Is(err, ErrNotSupported) {
+		test.Errorf("Expected ErrNotSupported, got %v", err)
+	}
+	testWrapper.AssertNoError(supported("crypt_init"))
+}
@@ -0,0 +1,68 @@
+package cryptsetup
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+var (
+	confirmFuncsMux = sync.Mutex{}
+	confirmFuncs    = map[*crypt.CryptDevice]func(msg string) bool{}
+
+	// confirmCallback is shared by all devices, as purego callbacks are limited and never released.
+	confirmCallbackOnce sync.Once
+	confirmCallback     uintptr
+)
+
+// SetConfirmCallback sets the function libcryptsetup asks before destructive actions,
+// e.g. HeaderRestore replacing an existing header. The action is only taken if confirm returns true,
+// so unattended tools can deny by default, while interactive tools can prompt with msg.
+// confirm must not call methods of the same Device.
+// A nil confirm restores the default of proceeding without asking.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_confirm_callback
+func (device *Device) SetConfirmCallback(confirm func(msg string) bool) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	confirmFuncsMux.Lock()
+	defer confirmFuncsMux.Unlock()
+
+	if confirm == nil {
+		delete(confirmFuncs, device.cryptDevice)
+		crypt.SetConfirmCallback(device.cryptDevice, 0, nil)
+		return nil
+	}
+
+	confirmCallbackOnce.Do(func() {
+		confirmCallback = crypt.NewCallback(confirm_callback)
+	})
+	confirmFuncs[device.cryptDevice] = confirm
+	// The crypt_device pointer identifies the device, as Go pointers must not be kept by C code.
+	crypt.SetConfirmCallback(device.cryptDevice, confirmCallback, unsafe.Pointer(device.cryptDevice))
+	return nil
+}
+
+func confirm_callback(msg *byte, usrptr unsafe.Pointer) int32 {
+	confirmFuncsMux.Lock()
+	confirm, ok := confirmFuncs[(*crypt.CryptDevice)(usrptr)]
+	confirmFuncsMux.Unlock()
+
+	if ok && confirm(strings.GoString(msg)) {
+		return 1
+	}
+	return 0
+}
+
+// forgetConfirmCallback drops the confirm function of a crypt device that is freed.
+func forgetConfirmCallback(cd *crypt.CryptDevice) {
+	confirmFuncsMux.Lock()
+	defer confirmFuncsMux.Unlock()
+
+	delete(confirmFuncs, cd)
+}
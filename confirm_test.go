@@ -0,0 +1,71 @@
+package cryptsetup
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Device_SetConfirmCallback(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	backupFile := filepath.Join(test.TempDir(), "header")
+	testWrapper.AssertNoError(device.HeaderBackup("", backupFile))
+
+	// Restoring over an existing header asks for confirmation.
+	var messages []string
+	testWrapper.AssertNoError(device.SetConfirmCallback(func(msg string) bool {
+		messages = append(messages, msg)
+		return false
+	}))
+	testWrapper.AssertError(device.HeaderRestore(CRYPT_LUKS2, backupFile))
+	if len(messages) != 1 || messages[0] == "" {
+		test.Fatalf("Expected one confirmation message, got %q", messages)
+	}
+
+	testWrapper.AssertNoError(device.SetConfirmCallback(func(msg string) bool {
+		messages = append(messages, msg)
+		return true
+	}))
+	testWrapper.AssertNoError(device.HeaderRestore(CRYPT_LUKS2, backupFile))
+	if len(messages) != 2 {
+		test.Errorf("Expected a second confirmation message, got %q", messages)
+	}
+
+	// Without a callback, libcryptsetup proceeds without asking.
+	testWrapper.AssertNoError(device.SetConfirmCallback(nil))
+	testWrapper.AssertNoError(device.HeaderRestore(CRYPT_LUKS2, backupFile))
+	if len(messages) != 2 {
+		test.Errorf("Expected no further confirmation, got %q", messages)
+	}
+}
+
+func Test_Device_SetConfirmCallback_Per_Device(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	denying, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer denying.Free()
+	err = denying.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	backupFile := filepath.Join(test.TempDir(), "header")
+	testWrapper.AssertNoError(denying.HeaderBackup("", backupFile))
+	testWrapper.AssertNoError(denying.SetConfirmCallback(func(string) bool { return false }))
+
+	confirming, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer confirming.Free()
+	testWrapper.AssertNoError(confirming.Load(nil))
+	testWrapper.AssertNoError(confirming.SetConfirmCallback(func(string) bool { return true }))
+
+	testWrapper.AssertError(denying.HeaderRestore(CRYPT_LUKS2, backupFile))
+	testWrapper.AssertNoError(confirming.HeaderRestore(CRYPT_LUKS2, backupFile))
+
+	denying.Free()
+	testWrapper.AssertError(denying.SetConfirmCallback(nil))
+}
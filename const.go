@@ -4,9 +4,18 @@ const (
 	/** enable discards aka trim */
 	CRYPT_ACTIVATE_ALLOW_DISCARDS = 0x8
 
+	/** key may be unbound to a data segment (LUKS2 only) */
+	CRYPT_ACTIVATE_ALLOW_UNBOUND_KEY = 0x10000
+
+	/** dm-verity: check_at_most_once - verify data blocks only the first time they are read */
+	CRYPT_ACTIVATE_CHECK_AT_MOST_ONCE = 0x8000
+
 	/** corruption detected (verity), output only */
 	CRYPT_ACTIVATE_CORRUPTED = 0x20
 
+	/** dm-crypt: use high priority workqueues (libcryptsetup >= 2.7) */
+	CRYPT_ACTIVATE_HIGH_PRIORITY = 0x8000000
+
 	/** dm-verity: ignore_corruption flag - ignore corruption, log it only */
 	CRYPT_ACTIVATE_IGNORE_CORRUPTION = 0x100
 
@@ -16,53 +25,99 @@ const (
 	/** dm-verity: ignore_zero_blocks - do not verify zero blocks */
 	CRYPT_ACTIVATE_IGNORE_ZERO_BLOCKS = 0x400
 
+	/** dm-crypt: plain64 IV uses large sectors instead of 512-byte sectors */
+	CRYPT_ACTIVATE_IV_LARGE_SECTORS = 0x400000
+
 	/** key loaded in kernel keyring instead directly in dm-crypt */
 	CRYPT_ACTIVATE_KEYRING_KEY = 0x800
 
 	/** dm-integrity: direct writes, do not use journal */
 	CRYPT_ACTIVATE_NO_JOURNAL = 0x1000
 
+	/** dm-integrity: use bitmap instead of journal */
+	CRYPT_ACTIVATE_NO_JOURNAL_BITMAP = 0x100000
+
+	/** dm-crypt: bypass internal workqueue and process read requests synchronously */
+	CRYPT_ACTIVATE_NO_READ_WORKQUEUE = 0x1000000
+
 	/** only reported for device without uuid */
 	CRYPT_ACTIVATE_NO_UUID = 0x2
 
+	/** dm-crypt: bypass internal workqueue and process write requests synchronously */
+	CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE = 0x2000000
+
+	/** dm-verity: panic_on_corruption flag - panic kernel on corruption */
+	CRYPT_ACTIVATE_PANIC_ON_CORRUPTION = 0x800000
+
 	/** skip global udev rules in activation ("private device"), input only */
 	CRYPT_ACTIVATE_PRIVATE = 0x10
 
 	/** device is read only */
 	CRYPT_ACTIVATE_READONLY = 0x1
 
+	/** dm-integrity: recalculate tags */
+	CRYPT_ACTIVATE_RECALCULATE = 0x20000
+
+	/** dm-integrity: reset and recalculate all tags */
+	CRYPT_ACTIVATE_RECALCULATE_RESET = 0x4000000
+
 	/** dm-integrity: recovery mode - no journal, no integrity checks */
 	CRYPT_ACTIVATE_RECOVERY = 0x2000
 
+	/** reload the table of an active device with new flags, input only */
+	CRYPT_ACTIVATE_REFRESH = 0x40000
+
 	/** dm-verity: restart_on_corruption flag - restart kernel on corruption */
 	CRYPT_ACTIVATE_RESTART_ON_CORRUPTION = 0x200
 
 	/** use same_cpu_crypt option for dm-crypt */
 	CRYPT_ACTIVATE_SAME_CPU_CRYPT = 0x40
 
+	/** serialize memory hard PBKDF computations to limit memory use */
+	CRYPT_ACTIVATE_SERIALIZE_MEMORY_HARD_PBKDF = 0x80000
+
 	/** activate even if cannot grant exclusive access (dangerous) */
 	CRYPT_ACTIVATE_SHARED = 0x4
 
 	/** use submit_from_crypt_cpus for dm-crypt */
 	CRYPT_ACTIVATE_SUBMIT_FROM_CRYPT_CPUS = 0x80
 
+	/** activate the device in suspended state */
+	CRYPT_ACTIVATE_SUSPENDED = 0x200000
+
 	/** iterate through all keyslots and find first one that fits */
 	CRYPT_ANY_SLOT = -0x1
 
 	/** iterate through all tokens */
 	CRYPT_ANY_TOKEN = -0x1
+
+	/** BITLK (BitLocker-compatible) mode */
+	CRYPT_BITLK = "BITLK"
+
 	/** lazy deactivation - remove once last user releases it */
 	CRYPT_DEACTIVATE_DEFERRED = 0x1
 
 	/** force deactivation - if the device is busy, it is replaced by error device */
 	CRYPT_DEACTIVATE_FORCE = 0x2
 
+	/** cancel a pending deferred deactivation (libcryptsetup >= 2.6) */
+	CRYPT_DEACTIVATE_DEFERRED_CANCEL = 0x4
+
 	/** debug all */
 	CRYPT_DEBUG_ALL = -0x1
 
 	/** debug none */
 	CRYPT_DEBUG_NONE = 0x0
 
+	/** persistent activation flags stored in header */
+	CRYPT_FLAGS_ACTIVATION = 0x0
+
+	/** requirement flags stored in header */
+	CRYPT_FLAGS_REQUIREMENTS = 0x1
+
+	/** FVAULT2 (FileVault2-compatible) mode */
+	CRYPT_FVAULT2 = "FVAULT2"
+
 	/** integrity dm-integrity device */
 	CRYPT_INTEGRITY = "INTEGRITY"
 
@@ -108,9 +163,42 @@ const (
 	/** plain crypt device, no on-disk header */
 	CRYPT_PLAIN = "PLAIN"
 
+	/** reencryption runs backward, from the end of the device */
+	CRYPT_REENCRYPT_BACKWARD = 0x1
+
+	/** decrypt LUKS2 device (remove encryption) */
+	CRYPT_REENCRYPT_DECRYPT = 0x2
+
+	/** encrypt LUKS2 device (in-place encryption) */
+	CRYPT_REENCRYPT_ENCRYPT = 0x1
+
+	/** reencryption runs forward, from the start of the device */
+	CRYPT_REENCRYPT_FORWARD = 0x0
+
+	/** initialize reencryption metadata only */
+	CRYPT_REENCRYPT_INITIALIZE_ONLY = 0x1
+
+	/** move the first segment; used only with data shift */
+	CRYPT_REENCRYPT_MOVE_FIRST_SEGMENT = 0x2
+
+	/** run reencryption recovery only */
+	CRYPT_REENCRYPT_RECOVERY = 0x8
+
+	/** change the volume key of a LUKS2 device */
+	CRYPT_REENCRYPT_REENCRYPT = 0x0
+
+	/** reencryption requires metadata repair */
+	CRYPT_REENCRYPT_REPAIR_NEEDED = 0x10
+
+	/** resume already initialized reencryption only */
+	CRYPT_REENCRYPT_RESUME_ONLY = 0x4
+
 	/** unfinished offline reencryption */
 	CRYPT_REQUIREMENT_OFFLINE_REENCRYPT = 0x1
 
+	/** online reencryption in progress */
+	CRYPT_REQUIREMENT_ONLINE_REENCRYPT = 0x2
+
 	/** unknown requirement in header (output only) */
 	CRYPT_REQUIREMENT_UNKNOWN = 0x80000000
 
@@ -172,6 +260,36 @@ const (
 	CRYPT_WIPE_SPECIAL = 0x3
 )
 
+// StatusInfo is an enum type for the status of an active device.
+type StatusInfo int
+
+const (
+	// device status could not be determined.
+	CRYPT_INVALID = 0x0
+	// device is not active.
+	CRYPT_INACTIVE = 0x1
+	// device is active.
+	CRYPT_ACTIVE = 0x2
+	// device is active and in use.
+	CRYPT_BUSY = 0x3
+)
+
+// KeyslotInfo is an enum type for keyslot information.
+type KeyslotInfo int
+
+const (
+	// keyslot is invalid.
+	CRYPT_SLOT_INVALID = 0x0
+	// keyslot is empty (free).
+	CRYPT_SLOT_INACTIVE = 0x1
+	// keyslot is active (used).
+	CRYPT_SLOT_ACTIVE = 0x2
+	// keyslot is the last active keyslot.
+	CRYPT_SLOT_ACTIVE_LAST = 0x3
+	// keyslot is active and not bound to any crypt segment (LUKS2 only).
+	CRYPT_SLOT_UNBOUND = 0x4
+)
+
 // TokenInfo is an enum type for token information.
 type TokenInfo int
 
@@ -181,7 +299,7 @@ const (
 	// token is empty (free).
 	CRYPT_TOKEN_INACTIVE = 0x1
 	// active internal token with driver.
-	CRYPT_TOKEN_INTERNAL = 0x3
+	CRYPT_TOKEN_INTERNAL = 0x2
 	// active internal token (reserved name) with missing token driver.
 	CRYPT_TOKEN_INTERNAL_UNKNOWN = 0x3
 	// active external (user defined) token with driver
@@ -0,0 +1,229 @@
+package cryptsetup
+
+import (
+	"fmt"
+	gostrings "strings"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// ConvertBlockerKind is an enum type for reasons preventing a header conversion.
+type ConvertBlockerKind int
+
+const (
+	// the header is not LUKS1 or LUKS2, or already has the requested type.
+	ConvertBlockerType ConvertBlockerKind = iota + 1
+	// the space before the data area cannot hold the converted metadata and keyslots.
+	ConvertBlockerMetadataArea
+	// a keyslot uses a PBKDF not supported by LUKS1, or is unbound.
+	ConvertBlockerKeyslotPBKDF
+	// a keyslot number is not available in LUKS1.
+	ConvertBlockerKeyslotNumber
+	// the header contains tokens, which LUKS1 does not support.
+	ConvertBlockerTokens
+	// the data area uses an encryption sector size other than 512 bytes.
+	ConvertBlockerSectorSize
+	// the data area uses authenticated encryption.
+	ConvertBlockerIntegrity
+	// the header has requirement flags set, e.g. by an unfinished reencryption.
+	ConvertBlockerRequirements
+)
+
+// ConvertBlocker describes a property of a header that prevents its conversion.
+type ConvertBlocker struct {
+	Kind ConvertBlockerKind
+	// Keyslot is the affected keyslot, or -1 if the blocker is not keyslot specific.
+	Keyslot int
+	Message string
+}
+
+func (blocker ConvertBlocker) String() string {
+	return blocker.Message
+}
+
+// ConvertError is returned by Convert if the header cannot be converted.
+type ConvertError struct {
+	Blockers []ConvertBlocker
+}
+
+func (e *ConvertError) Error() string {
+	messages := make([]string, 0, len(e.Blockers))
+	for _, blocker := range e.Blockers {
+		messages = append(messages, blocker.Message)
+	}
+	return fmt.Sprintf("cannot convert header: %s", gostrings.Join(messages, "; "))
+}
+
+const (
+	// luks1KeyslotsOffset is the offset of the first LUKS1 keyslot area in bytes.
+	luks1KeyslotsOffset = 4096
+	// luks2HeadersSize is the size of both LUKS2 headers in a header converted from LUKS1, in bytes.
+	luks2HeadersSize = 2 * 16384
+	// luks1KeyslotsMax is the number of LUKS1 keyslots.
+	luks1KeyslotsMax = 8
+)
+
+// CheckConvert checks whether the loaded header can be converted to deviceType without writing anything.
+// Returns the blockers preventing the conversion, which are empty if it is possible, or an error otherwise.
+func (device *Device) CheckConvert(deviceType DeviceType) ([]ConvertBlocker, error) {
+	if err := device.lock(); err != nil {
+		return nil, err
+	}
+	defer device.mux.Unlock()
+
+	return device.checkConvert(deviceType.Name())
+}
+
+// Convert converts a loaded LUKS1 header to LUKS2, or a LUKS2 header back to LUKS1.
+// The header is checked with CheckConvert first, and a *ConvertError listing the blockers is returned if the conversion is not possible.
+// If backupFile is not empty, a header backup is written to it before the conversion; it must not exist yet.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_convert
+func (device *Device) Convert(deviceType DeviceType, backupFile string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	blockers, err := device.checkConvert(deviceType.Name())
+	if err != nil {
+		return err
+	}
+	if len(blockers) > 0 {
+		return &ConvertError{Blockers: blockers}
+	}
+
+	if backupFile != "" {
+		if err := device.headerBackup("", backupFile); err != nil {
+			return err
+		}
+	}
+
+	cDeviceType := strings.CString(deviceType.Name())
+	defer strings.CFree(cDeviceType)
+
+	cParams, freeCParams := deviceType.Unmanaged()
+	defer freeCParams()
+
+	if res := crypt.Convert(device.cryptDevice, cDeviceType, cParams); res < 0 {
+		return &Error{functionName: "crypt_convert", code: int(res)}
+	}
+	return nil
+}
+
+func (device *Device) checkConvert(deviceType string) ([]ConvertBlocker, error) {
+	cd := device.cryptDevice
+	currentType := strings.GoString(crypt.GetType(cd))
+
+	switch {
+	case currentType == CRYPT_LUKS1 && deviceType == CRYPT_LUKS2:
+		return device.checkConvertToLUKS2()
+	case currentType == CRYPT_LUKS2 && deviceType == CRYPT_LUKS1:
+		return device.checkConvertToLUKS1()
+	default:
+		return []ConvertBlocker{{
+			Kind:    ConvertBlockerType,
+			Keyslot: -1,
+			Message: fmt.Sprintf("conversion from %q to %q is not supported", currentType, deviceType),
+		}}, nil
+	}
+}
+
+func (device *Device) checkConvertToLUKS2() ([]ConvertBlocker, error) {
+	cd := device.cryptDevice
+
+	var blockers []ConvertBlocker
+	if crypt.GetMetadataDeviceName(cd) == nil {
+		// The LUKS1 keyslots area is moved behind both LUKS2 headers.
+		var keyslotsEnd uint64
+		for keyslot := 0; keyslot < luks1KeyslotsMax; keyslot++ {
+			var offset, length uint64
+			if res := crypt.KeyslotArea(cd, int32(keyslot), &offset, &length); res < 0 {
+				return nil, &Error{functionName: "crypt_keyslot_area", code: int(res)}
+			}
+			if offset+length > keyslotsEnd {
+				keyslotsEnd = offset + length
+			}
+		}
+		dataOffset := crypt.GetDataOffset(cd) * 512
+		if required := luks2HeadersSize + keyslotsEnd - luks1KeyslotsOffset; required > dataOffset {
+			blockers = append(blockers, ConvertBlocker{
+				Kind:    ConvertBlockerMetadataArea,
+				Keyslot: -1,
+				Message: fmt.Sprintf("LUKS2 metadata needs %d bytes, but the data area starts at %d bytes", required, dataOffset),
+			})
+		}
+	}
+	return blockers, nil
+}
+
+func (device *Device) checkConvertToLUKS1() ([]ConvertBlocker, error) {
+	cd := device.cryptDevice
+
+	var blockers []ConvertBlocker
+	block := func(kind ConvertBlockerKind, keyslot int, format string, a ...any) {
+		blockers = append(blockers, ConvertBlocker{Kind: kind, Keyslot: keyslot, Message: fmt.Sprintf(format, a...)})
+	}
+
+	cLUKS2 := strings.CString(CRYPT_LUKS2)
+	defer strings.CFree(cLUKS2)
+	keyslotMax := crypt.KeyslotMax(cLUKS2)
+	for keyslot := 0; keyslot < int(keyslotMax); keyslot++ {
+		status := KeyslotInfo(crypt.KeyslotStatus(cd, int32(keyslot)))
+		switch status {
+		case CRYPT_SLOT_INVALID, CRYPT_SLOT_INACTIVE:
+			continue
+		case CRYPT_SLOT_UNBOUND:
+			block(ConvertBlockerKeyslotPBKDF, keyslot, "keyslot %d is unbound", keyslot)
+			continue
+		}
+		if keyslot >= luks1KeyslotsMax {
+			block(ConvertBlockerKeyslotNumber, keyslot, "keyslot %d exceeds the %d LUKS1 keyslots", keyslot, luks1KeyslotsMax)
+		}
+		var cPBKDF crypt.PBKDFType
+		if res := crypt.KeyslotGetPBKDF(cd, int32(keyslot), &cPBKDF); res < 0 {
+			return nil, &Error{functionName: "crypt_keyslot_get_pbkdf", code: int(res)}
+		}
+		if pbkdfType := strings.GoString(cPBKDF.Type); pbkdfType != CRYPT_KDF_PBKDF2 {
+			block(ConvertBlockerKeyslotPBKDF, keyslot, "keyslot %d uses PBKDF %s instead of %s", keyslot, pbkdfType, CRYPT_KDF_PBKDF2)
+		}
+	}
+
+	tokenMax := int(crypt.TokenMax(cLUKS2))
+	if tokenMax < 0 {
+		tokenMax = luks2TokensMax
+	}
+	var tokens int
+	for token := 0; token < tokenMax; token++ {
+		var cTokenType *byte
+		if status := crypt.TokenStatus(cd, uint32(token), &cTokenType); status != CRYPT_TOKEN_INVALID && status != CRYPT_TOKEN_INACTIVE {
+			tokens++
+		}
+	}
+	if tokens > 0 {
+		block(ConvertBlockerTokens, -1, "header contains %d token(s)", tokens)
+	}
+
+	if sectorSize := crypt.GetSectorSize(cd); sectorSize != 512 {
+		block(ConvertBlockerSectorSize, -1, "encryption sector size is %d instead of 512 bytes", sectorSize)
+	}
+
+	var cIntegrity crypt.ParamsIntegrity
+	if res := crypt.GetIntegrityInfo(cd, &cIntegrity); res < 0 {
+		return nil, &Error{functionName: "crypt_get_integrity_info", code: int(res)}
+	}
+	if cIntegrity.Integrity != nil {
+		block(ConvertBlockerIntegrity, -1, "data area uses authenticated encryption %s", strings.GoString(cIntegrity.Integrity))
+	}
+
+	var requirements uint32
+	if res := crypt.PersistentFlagsGet(cd, CRYPT_FLAGS_REQUIREMENTS, &requirements); res < 0 {
+		return nil, &Error{functionName: "crypt_persistent_flags_get", code: int(res)}
+	}
+	if requirements != 0 {
+		block(ConvertBlockerRequirements, -1, "header has requirements %#x", requirements)
+	}
+
+	return blockers, nil
+}
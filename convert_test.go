@@ -0,0 +1,106 @@
+package cryptsetup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_Device_Convert_LUKS1_To_LUKS2_And_Back(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	_, err = device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	backupFile := filepath.Join(test.TempDir(), "luks1-header")
+	testWrapper.AssertNoError(device.Convert(LUKS2{}, backupFile))
+	if device.Type() != CRYPT_LUKS2 {
+		test.Errorf("Expected LUKS2 after conversion, got %s", device.Type())
+	}
+	if _, err := os.Stat(backupFile); err != nil {
+		test.Errorf("Expected header backup: %v", err)
+	}
+	_, _, err = device.VolumeKeyGet(CRYPT_ANY_SLOT, PassKey)
+	testWrapper.AssertNoError(err)
+
+	// The backup file must not be overwritten.
+	testWrapper.AssertError(device.Convert(LUKS1{}, backupFile))
+	if device.Type() != CRYPT_LUKS2 {
+		test.Errorf("Expected LUKS2 after failed conversion, got %s", device.Type())
+	}
+
+	testWrapper.AssertNoError(device.Convert(LUKS1{}, ""))
+	if device.Type() != CRYPT_LUKS1 {
+		test.Errorf("Expected LUKS1 after conversion, got %s", device.Type())
+	}
+	_, _, err = device.VolumeKeyGet(CRYPT_ANY_SLOT, PassKey)
+	testWrapper.AssertNoError(err)
+}
+
+func Test_Device_CheckConvert_Metadata_Area(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256", DataAlignment: 8}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	blockers, err := device.CheckConvert(LUKS2{})
+	testWrapper.AssertNoError(err)
+	if len(blockers) != 1 || blockers[0].Kind != ConvertBlockerMetadataArea {
+		test.Errorf("Expected metadata area blocker, got %v", blockers)
+	}
+}
+
+func Test_Device_CheckConvert_LUKS2_Blockers(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_ARGON2ID, Hash: "sha256", Iterations: 4, MaxMemoryKb: 32, ParallelThreads: 1, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf, SectorSize: 4096}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+	_, err = device.TokenJSONSet(CRYPT_ANY_TOKEN, `{"type": "some-token", "keyslots": []}`)
+	testWrapper.AssertNoError(err)
+
+	blockers, err := device.CheckConvert(LUKS1{})
+	testWrapper.AssertNoError(err)
+	kinds := make(map[ConvertBlockerKind]ConvertBlocker)
+	for _, blocker := range blockers {
+		kinds[blocker.Kind] = blocker
+	}
+	if len(kinds) != 3 || kinds[ConvertBlockerKeyslotPBKDF].Keyslot != keyslot {
+		test.Errorf("Unexpected blockers %v", blockers)
+	}
+	for _, kind := range []ConvertBlockerKind{ConvertBlockerKeyslotPBKDF, ConvertBlockerTokens, ConvertBlockerSectorSize} {
+		if _, ok := kinds[kind]; !ok {
+			test.Errorf("Missing blocker %d in %v", kind, blockers)
+		}
+	}
+
+	backupFile := filepath.Join(test.TempDir(), "luks2-header")
+	err = device.Convert(LUKS1{}, backupFile)
+	var convertErr *ConvertError
+	if !errors.As(err, &convertErr) || len(convertErr.Blockers) != len(blockers) {
+		test.Errorf("Expected *ConvertError, got %v", err)
+	}
+	if _, err := os.Stat(backupFile); !os.IsNotExist(err) {
+		test.Error("Header backup should not be written if the conversion is blocked")
+	}
+
+	blockers, err = device.CheckConvert(LUKS2{})
+	testWrapper.AssertNoError(err)
+	if len(blockers) != 1 || blockers[0].Kind != ConvertBlockerType {
+		test.Errorf("Expected type blocker, got %v", blockers)
+	}
+}
@@ -0,0 +1,140 @@
+// Package cryptsetupfake provides an in-memory replacement for libcryptsetup.
+//
+// Once installed, package cryptsetup runs against the fake instead of loading
+// libcryptsetup, so code managing keyslots, tokens and activations can be tested
+// with go test as an unprivileged user. Headers, keyslots and active devices only
+// exist in memory; nothing is written to disk and no device-mapper devices are created.
+// Key derivation is not simulated, passphrases are compared as is.
+// Tokens with a "fake-pin" field in their JSON definition are PIN protected: activating
+// by such a token fails with -ENOANO unless ActivateByTokenPIN is given that PIN.
+// Active devices are never in use, so deferred and forced deactivations take effect
+// immediately and there is never a deferred removal to cancel.
+// Log messages, such as the output of Dump, are only passed to log callbacks and never printed.
+//
+// libc is still loaded from the system to pass data across the C interface.
+package cryptsetupfake
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+)
+
+// LibraryPath is reported as the path of the fake library by cryptsetup.Library.
+const LibraryPath = "cryptsetupfake"
+
+// Version is the libcryptsetup version emulated by the fake.
+const Version = "2.4"
+
+// Backend holds the state of the fake libcryptsetup.
+// All methods are safe for concurrent use.
+type Backend struct {
+	mux      sync.Mutex
+	disks    map[string]*disk
+	active   map[string]*mapping
+	handles  map[*crypt.CryptDevice]*handle
+	handlers map[string]*crypt.TokenHandler
+}
+
+// disk is a block device known to the fake.
+type disk struct {
+	size   uint64
+	header *header
+}
+
+// header is the on-disk metadata of a LUKS device, or the in-memory parameters of a plain device.
+type header struct {
+	deviceType string
+	cipher     string
+	cipherMode string
+	uuid       string
+	label      string
+	subsystem  string
+	volumeKey  []byte
+	// keyslots maps keyslot numbers to the passphrase unlocking them.
+	keyslots map[int][]byte
+	// tokens maps token numbers to their JSON definition.
+	tokens map[int]string
+}
+
+// mapping is an active device.
+type mapping struct {
+	path   string
+	header *header
+	flags  uint32
+}
+
+var (
+	installOnce sync.Once
+	installErr  error
+	backend     *Backend
+)
+
+// Install replaces libcryptsetup with the fake for the rest of the process and returns its Backend.
+// It must be called before package cryptsetup loads libcryptsetup, e.g. in TestMain.
+// Subsequent calls return the same Backend.
+func Install() (*Backend, error) {
+	installOnce.Do(func() {
+		b := &Backend{
+			disks:    map[string]*disk{},
+			active:   map[string]*mapping{},
+			handles:  map[*crypt.CryptDevice]*handle{},
+			handlers: map[string]*crypt.TokenHandler{},
+		}
+		if installErr = crypt.Install(LibraryPath, Version, b.functions()); installErr == nil {
+			backend = b
+		}
+	})
+	return backend, installErr
+}
+
+// AddDevice adds an empty block device of the given size in bytes at path.
+// An existing device at path is replaced.
+func (b *Backend) AddDevice(path string, size uint64) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.disks[path] = &disk{size: size}
+}
+
+// RemoveDevice removes the block device at path.
+func (b *Backend) RemoveDevice(path string) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	delete(b.disks, path)
+}
+
+// IsActive reports whether a device with the given name is active.
+func (b *Backend) IsActive(name string) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	_, ok := b.active[name]
+	return ok
+}
+
+// ActiveDevices returns the names of all active devices, sorted.
+func (b *Backend) ActiveDevices() []string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	names := make([]string, 0, len(b.active))
+	for name := range b.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reset removes all block devices and active devices.
+// Registered token handlers are kept, as they are with libcryptsetup.
+func (b *Backend) Reset() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.disks = map[string]*disk{}
+	b.active = map[string]*mapping{}
+}
+
+func (h *header) String() string {
+	return fmt.Sprintf("%s header\nUUID:\t%s\nCipher:\t%s-%s\nLabel:\t%s\nSubsystem:\t%s\n",
+		h.deviceType, h.uuid, h.cipher, h.cipherMode, h.label, h.subsystem)
+}
@@ -0,0 +1,455 @@
+package cryptsetupfake_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	cryptsetup "github.com/malt3/purego-cryptsetup"
+	"github.com/malt3/purego-cryptsetup/cryptsetupfake"
+)
+
+const (
+	devicePath = "/dev/fake0"
+	deviceName = "fakeDeviceName"
+)
+
+var backend *cryptsetupfake.Backend
+
+func TestMain(m *testing.M) {
+	var err error
+	if backend, err = cryptsetupfake.Install(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func setup(test *testing.T) *cryptsetup.Device {
+	test.Helper()
+	backend.Reset()
+	backend.AddDevice(devicePath, 64<<20)
+
+	device, err := cryptsetup.Init(devicePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { device.Free() })
+
+	err = device.Format(cryptsetup.LUKS2{SectorSize: 512, Label: "data"}, cryptsetup.GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 64})
+	if err != nil {
+		test.Fatal(err)
+	}
+	return device
+}
+
+func assertErrorCode(test *testing.T, err error, code int) {
+	test.Helper()
+	var cryptErr *cryptsetup.Error
+	if !errors.As(err, &cryptErr) {
+		test.Fatalf("expected *cryptsetup.Error with code %d, got %v", code, err)
+	}
+	if cryptErr.Code() != code {
+		test.Errorf("expected error code %d, got %d", code, cryptErr.Code())
+	}
+}
+
+func TestInstall(test *testing.T) {
+	again, err := cryptsetupfake.Install()
+	if err != nil || again != backend {
+		test.Errorf("Install should return the installed backend, got %v, %v", again, err)
+	}
+
+	library, err := cryptsetup.Open(cryptsetup.LibraryOptions{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if library.CryptsetupPath() != cryptsetupfake.LibraryPath {
+		test.Errorf("unexpected library path %q", library.CryptsetupPath())
+	}
+	if !library.Capabilities().TokenPIN {
+		test.Error("fake should support token PINs")
+	}
+}
+
+func TestInit(test *testing.T) {
+	backend.Reset()
+
+	_, err := cryptsetup.Init("nonExistingDevicePath")
+	assertErrorCode(test, err, -15)
+
+	_, err = cryptsetup.InitByName("nonExistingMappedDevice")
+	assertErrorCode(test, err, -19)
+
+	backend.AddDevice(devicePath, 64<<20)
+	device, err := cryptsetup.Init(devicePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer device.Free()
+	if device.Type() != "" {
+		test.Error("device should have no type")
+	}
+	if device.GetDeviceName() != devicePath {
+		test.Errorf("unexpected device name %q", device.GetDeviceName())
+	}
+	assertErrorCode(test, device.ActivateByPassphrase(deviceName, 0, "passphrase", 0), -22)
+	assertErrorCode(test, device.Load(nil), -22)
+}
+
+func TestKeyslots(test *testing.T) {
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(0, "", "first"); err != nil {
+		test.Fatal(err)
+	}
+	if err := device.KeyslotAddByPassphrase(1, "first", "second"); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, device.KeyslotAddByPassphrase(2, "wrong", "third"), -1)
+	assertErrorCode(test, device.KeyslotAddByPassphrase(1, "first", "third"), -22)
+
+	volumeKey, keyslot, err := device.VolumeKeyGet(cryptsetup.CRYPT_ANY_SLOT, "second")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(volumeKey) != 64 || keyslot != 1 {
+		test.Errorf("unexpected volume key of size %d from keyslot %d", len(volumeKey), keyslot)
+	}
+
+	if err := device.KeyslotChangeByPassphrase(1, 1, "second", "changed"); err != nil {
+		test.Fatal(err)
+	}
+	_, _, err = device.VolumeKeyGet(cryptsetup.CRYPT_ANY_SLOT, "second")
+	assertErrorCode(test, err, -1)
+
+	// The header is shared by all contexts of the device.
+	loaded, err := cryptsetup.Init(devicePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer loaded.Free()
+	if err := loaded.Load(cryptsetup.LUKS2{}); err != nil {
+		test.Fatal(err)
+	}
+	if loaded.Type() != cryptsetup.CRYPT_LUKS2 || loaded.GetUUID() != device.GetUUID() {
+		test.Errorf("loaded header differs: %s %s", loaded.Type(), loaded.GetUUID())
+	}
+	if _, _, err := loaded.VolumeKeyGet(1, "changed"); err != nil {
+		test.Error(err)
+	}
+	assertErrorCode(test, loaded.Load(cryptsetup.LUKS1{}), -22)
+}
+
+func TestMetadata(test *testing.T) {
+	device := setup(test)
+
+	label, err := device.GetLabel()
+	if err != nil || label != "data" {
+		test.Errorf("unexpected label %q, %v", label, err)
+	}
+	if err := device.SetLabel("relabeled", "subsystem"); err != nil {
+		test.Fatal(err)
+	}
+	label, _ = device.GetLabel()
+	subsystem, _ := device.GetSubsystem()
+	if label != "relabeled" || subsystem != "subsystem" {
+		test.Errorf("unexpected label %q and subsystem %q", label, subsystem)
+	}
+
+	uuid := device.GetUUID()
+	if err := device.SetUUID(""); err != nil {
+		test.Fatal(err)
+	}
+	if device.GetUUID() == uuid {
+		test.Error("UUID should have been regenerated")
+	}
+	assertErrorCode(test, device.SetUUID("not-a-uuid"), -22)
+
+	info, err := device.Info()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if info.Type != cryptsetup.CRYPT_LUKS2 || info.Cipher != "aes" || info.CipherMode != "xts-plain64" || info.VolumeKeySize != 64 || info.Label != "relabeled" {
+		test.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestActivation(test *testing.T) {
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(0, "", "passphrase"); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, device.ActivateByPassphrase(deviceName, 0, "wrong", 0), -1)
+	if err := device.ActivateByPassphrase(deviceName, 0, "passphrase", 0); err != nil {
+		test.Fatal(err)
+	}
+	if !backend.IsActive(deviceName) {
+		test.Fatal("device should be active")
+	}
+	assertErrorCode(test, device.ActivateByPassphrase(deviceName, 0, "passphrase", 0), -17)
+
+	active, err := cryptsetup.InitByName(deviceName)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer active.Free()
+	if active.Type() != cryptsetup.CRYPT_LUKS2 {
+		test.Errorf("unexpected type %q", active.Type())
+	}
+
+	if err := active.Deactivate(deviceName); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, active.Deactivate(deviceName), -19)
+	if len(backend.ActiveDevices()) != 0 {
+		test.Errorf("unexpected active devices %v", backend.ActiveDevices())
+	}
+
+	if err := device.ActivateByVolumeKey(deviceName, "", 64, 0); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, device.ActivateByVolumeKey("other", string(make([]byte, 64)), 64, 0), -1)
+}
+
+func TestTokens(test *testing.T) {
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(0, "", "passphrase"); err != nil {
+		test.Fatal(err)
+	}
+	_, err := device.TokenJSONGet(0)
+	assertErrorCode(test, err, -2)
+	_, err = device.TokenJSONSet(0, `{"type": "missing-keyslots"}`)
+	assertErrorCode(test, err, -22)
+	_, err = device.TokenJSONSet(0, `{"type": "unknown-keyslot", "keyslots": ["3"]}`)
+	assertErrorCode(test, err, -22)
+
+	token, err := device.TokenJSONSet(cryptsetup.CRYPT_ANY_TOKEN, `{"type": "fake-external", "keyslots": []}`)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if token != 0 {
+		test.Errorf("expected token 0, got %d", token)
+	}
+	tokenType, status := device.TokenStatus(token)
+	if tokenType != "fake-external" || status != cryptsetup.CRYPT_TOKEN_EXTERNAL_UNKNOWN {
+		test.Errorf("unexpected token status %q %d", tokenType, status)
+	}
+
+	assertErrorCode(test, device.TokenIsAssigned(token, 0), -2)
+	if err := device.TokenAssignKeyslot(token, 0); err != nil {
+		test.Fatal(err)
+	}
+	if err := device.TokenIsAssigned(token, 0); err != nil {
+		test.Error(err)
+	}
+	if err := device.TokenUnassignKeyslot(token, 0); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, device.TokenIsAssigned(token, 0), -2)
+
+	keyringToken, err := device.TokenLUKS2KeyRingSet(cryptsetup.CRYPT_ANY_TOKEN, cryptsetup.TokenParamsLUKS2Keyring{KeyDescription: "fake:key"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	params, err := device.TokenLUKS2KeyRingGet(keyringToken)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if params.KeyDescription != "fake:key" {
+		test.Errorf("unexpected key description %q", params.KeyDescription)
+	}
+	if _, status := device.TokenStatus(keyringToken); status != cryptsetup.CRYPT_TOKEN_INTERNAL {
+		test.Errorf("unexpected keyring token status %d", status)
+	}
+}
+
+// staticToken is a token handler returning the passphrase stored in the token.
+type staticToken struct{}
+
+func (staticToken) Name() string { return "fake-static" }
+
+func (staticToken) Open(token int, tokenJSON string) ([]byte, error) {
+	var static struct {
+		Passphrase string `json:"passphrase"`
+	}
+	if err := json.Unmarshal([]byte(tokenJSON), &static); err != nil {
+		return nil, err
+	}
+	return []byte(static.Passphrase), nil
+}
+
+func (staticToken) Validate(tokenJSON string) error {
+	_, err := cryptsetup.ParseToken(tokenJSON)
+	return err
+}
+
+func (staticToken) Dump(tokenJSON string) string { return "" }
+
+var registerStaticTokenOnce sync.Once
+
+// registerStaticToken registers staticToken once, as token handlers cannot be unregistered.
+func registerStaticToken(test *testing.T) {
+	test.Helper()
+	var err error
+	registerStaticTokenOnce.Do(func() { err = cryptsetup.TokenRegister(staticToken{}) })
+	if err != nil {
+		test.Fatal(err)
+	}
+}
+
+func TestActivateByToken(test *testing.T) {
+	registerStaticToken(test)
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(3, "", "passphrase"); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, device.ActivateByToken(deviceName, cryptsetup.CRYPT_ANY_TOKEN, "", 0), -2)
+
+	_, err := device.TokenJSONSet(cryptsetup.CRYPT_ANY_TOKEN, `{"type": "fake-static", "keyslots": ["3"], "passphrase": "passphrase"}`)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, status := device.TokenStatus(0); status != cryptsetup.CRYPT_TOKEN_EXTERNAL {
+		test.Errorf("unexpected token status %d", status)
+	}
+
+	if err := device.ActivateByToken(deviceName, cryptsetup.CRYPT_ANY_TOKEN, "", 0); err != nil {
+		test.Fatal(err)
+	}
+	if !backend.IsActive(deviceName) {
+		test.Error("device should be active")
+	}
+
+	keyslot, err := device.ActivateByTokenPIN("", "fake-static", 0, nil, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if keyslot != 3 {
+		test.Errorf("expected keyslot 3, got %d", keyslot)
+	}
+}
+
+func TestActivateByTokenPIN(test *testing.T) {
+	registerStaticToken(test)
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(2, "", "passphrase"); err != nil {
+		test.Fatal(err)
+	}
+	_, err := device.TokenJSONSet(cryptsetup.CRYPT_ANY_TOKEN, `{"type": "fake-static", "keyslots": ["2"], "passphrase": "passphrase", "fake-pin": "1234"}`)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	assertErrorCode(test, device.ActivateByToken(deviceName, cryptsetup.CRYPT_ANY_TOKEN, "", 0), -55)
+	_, err = device.ActivateByTokenPIN(deviceName, "fake-static", cryptsetup.CRYPT_ANY_TOKEN, nil, 0)
+	assertErrorCode(test, err, -55)
+	_, err = device.ActivateByTokenPIN(deviceName, "fake-static", cryptsetup.CRYPT_ANY_TOKEN, []byte("4321"), 0)
+	assertErrorCode(test, err, -55)
+	if backend.IsActive(deviceName) {
+		test.Error("device should not be active without the right PIN")
+	}
+
+	keyslot, err := device.ActivateByTokenPIN(deviceName, "fake-static", cryptsetup.CRYPT_ANY_TOKEN, []byte("1234"), 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if keyslot != 2 {
+		test.Errorf("expected keyslot 2, got %d", keyslot)
+	}
+	if !backend.IsActive(deviceName) {
+		test.Error("device should be active")
+	}
+}
+
+func TestStatusAndDeactivateByName(test *testing.T) {
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(0, "", "passphrase"); err != nil {
+		test.Fatal(err)
+	}
+	if err := device.ActivateByPassphrase(deviceName, 0, "passphrase", cryptsetup.CRYPT_ACTIVATE_READONLY); err != nil {
+		test.Fatal(err)
+	}
+
+	status, err := device.Status(deviceName)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if status.Status != cryptsetup.CRYPT_ACTIVE || status.Size != (64<<20)/512 || !status.Flags.Has(cryptsetup.CRYPT_ACTIVATE_READONLY) || status.DeferredRemove {
+		test.Errorf("unexpected status %+v", status)
+	}
+
+	if err := device.CancelDeferredRemoval(deviceName); !errors.Is(err, cryptsetup.ErrNotSupported) {
+		test.Errorf("expected cancelling to be unsupported by libcryptsetup %s, got %v", cryptsetupfake.Version, err)
+	}
+	if err := device.DeactivateByName(deviceName, cryptsetup.CRYPT_DEACTIVATE_DEFERRED); err != nil {
+		test.Fatal(err)
+	}
+	assertErrorCode(test, device.DeactivateByName(deviceName, cryptsetup.CRYPT_DEACTIVATE_FORCE), -19)
+
+	status, err = device.Status(deviceName)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if status.Status != cryptsetup.CRYPT_INACTIVE {
+		test.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestRefresh(test *testing.T) {
+	device := setup(test)
+
+	if err := device.KeyslotAddByVolumeKey(0, "", "passphrase"); err != nil {
+		test.Fatal(err)
+	}
+	_, err := device.RefreshByPassphrase(deviceName, 0, []byte("passphrase"), cryptsetup.CRYPT_ACTIVATE_NO_READ_WORKQUEUE, false)
+	assertErrorCode(test, err, -19)
+
+	flags := cryptsetup.CRYPT_ACTIVATE_READONLY | cryptsetup.CRYPT_ACTIVATE_ALLOW_DISCARDS
+	if err := device.ActivateByPassphrase(deviceName, 0, "passphrase", flags); err != nil {
+		test.Fatal(err)
+	}
+	_, err = device.RefreshByPassphrase(deviceName, 0, []byte("wrong"), cryptsetup.CRYPT_ACTIVATE_NO_READ_WORKQUEUE, false)
+	assertErrorCode(test, err, -1)
+
+	keyslot, err := device.RefreshByPassphrase(deviceName, 0, []byte("passphrase"), cryptsetup.CRYPT_ACTIVATE_NO_READ_WORKQUEUE|cryptsetup.CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE, false)
+	if err != nil || keyslot != 0 {
+		test.Fatalf("unexpected keyslot %d and error %v", keyslot, err)
+	}
+
+	status, err := device.Status(deviceName)
+	if err != nil {
+		test.Fatal(err)
+	}
+	expected := cryptsetup.ActivateFlags(cryptsetup.CRYPT_ACTIVATE_READONLY | cryptsetup.CRYPT_ACTIVATE_NO_READ_WORKQUEUE | cryptsetup.CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE)
+	if status.Flags != expected {
+		test.Errorf("expected flags %#x, got %#x", expected, status.Flags)
+	}
+}
+
+func TestWipeProgress(test *testing.T) {
+	device := setup(test)
+
+	var reported uint64
+	err := device.Wipe(devicePath, cryptsetup.CRYPT_WIPE_ZERO, 0, 1<<20, 0, 0, func(size, offset uint64) int {
+		reported = offset
+		return 0
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	if reported != 1<<20 {
+		test.Errorf("expected progress up to %d, got %d", 1<<20, reported)
+	}
+
+	err = device.Wipe(devicePath, cryptsetup.CRYPT_WIPE_ZERO, 0, 1<<20, 0, 0, func(size, offset uint64) int { return 1 })
+	assertErrorCode(test, err, -22)
+}
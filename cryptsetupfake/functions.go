@@ -0,0 +1,1131 @@
+package cryptsetupfake
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	gostrings "strings"
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/libc"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// Error codes returned by the fake, matching libcryptsetup's negative errno values.
+const (
+	errPERM    = -1
+	errNOENT   = -2
+	errNOMEM   = -12
+	errNOTBLK  = -15
+	errEXIST   = -17
+	errNODEV   = -19
+	errINVAL   = -22
+	errNOANO   = -55
+	errNOTSUP  = -95
+	anySlot    = -1
+	anyToken   = -1
+	maxTokens  = 32
+	typeLUKS1  = "LUKS1"
+	typeLUKS2  = "LUKS2"
+	typePlain  = "PLAIN"
+	keyringTok = "luks2-keyring"
+)
+
+// Token states reported by crypt_token_status.
+const (
+	tokenInvalid = iota
+	tokenInactive
+	tokenInternal
+	tokenInternalUnknown
+	tokenExternal
+	tokenExternalUnknown
+)
+
+// logNormal is CRYPT_LOG_NORMAL.
+const logNormal = 0
+
+// handle is the state behind a struct crypt_device.
+type handle struct {
+	path   string
+	header *header
+	// volumeKey is the volume key known to the context, e.g. after crypt_format.
+	volumeKey []byte
+	// cStrings are strings returned to the caller, which are owned by the context.
+	cStrings map[string]*byte
+	// log and logUsrptr are set by crypt_set_log_callback.
+	log       unsafe.Pointer
+	logUsrptr unsafe.Pointer
+}
+
+// logMessage passes msg to the log callback of the context.
+// Unlike libcryptsetup, which prints to stdout without a callback, the fake drops the message.
+// It must be called without holding the lock of the backend, as the callback may call into the fake.
+func (h *handle) logMessage(level int32, msg string) {
+	if h.log == nil {
+		return
+	}
+	var log func(int32, *byte, unsafe.Pointer)
+	crypt.RegisterFunc(&log, uintptr(h.log))
+
+	cMsg := strings.CString(msg)
+	defer strings.CFree(cMsg)
+	log(level, cMsg, h.logUsrptr)
+}
+
+// cString returns val as a C string owned by the context.
+// It stays valid until the next call with the same key.
+func (h *handle) cString(key, val string) *byte {
+	if old, ok := h.cStrings[key]; ok {
+		strings.CFree(old)
+	}
+	h.cStrings[key] = strings.CString(val)
+	return h.cStrings[key]
+}
+
+func (b *Backend) functions() map[string]any {
+	return map[string]any{
+		"crypt_init":                         b.init,
+		"crypt_init_by_name":                 b.initByName,
+		"crypt_free":                         b.free,
+		"crypt_dump":                         b.dump,
+		"crypt_get_type":                     b.getType,
+		"crypt_format":                       b.format,
+		"crypt_wipe":                         b.wipe,
+		"crypt_resize":                       b.resize,
+		"crypt_load":                         b.load,
+		"crypt_keyslot_add_by_volume_key":    b.keyslotAddByVolumeKey,
+		"crypt_keyslot_add_by_passphrase":    b.keyslotAddByPassphrase,
+		"crypt_keyslot_change_by_passphrase": b.keyslotChangeByPassphrase,
+		"crypt_activate_by_passphrase":       b.activateByPassphrase,
+		"crypt_activate_by_token":            b.activateByToken,
+		"crypt_activate_by_token_pin":        b.activateByTokenPIN,
+		"crypt_activate_by_volume_key":       b.activateByVolumeKey,
+		"crypt_deactivate":                   b.deactivate,
+		"crypt_deactivate_by_name":           b.deactivateByName,
+		"crypt_status":                       b.status,
+		"crypt_get_active_device":            b.getActiveDevice,
+		"crypt_set_debug_level":              func(int32) {},
+		"crypt_get_volume_key_size":          b.getVolumeKeySize,
+		"crypt_volume_key_get":               b.volumeKeyGet,
+		"crypt_get_device_name":              b.getDeviceName,
+		"crypt_get_uuid":                     b.getUUID,
+		"crypt_token_json_get":               b.tokenJSONGet,
+		"crypt_token_json_set":               b.tokenJSONSet,
+		"crypt_token_luks2_keyring_get":      b.tokenLUKS2KeyringGet,
+		"crypt_token_luks2_keyring_set":      b.tokenLUKS2KeyringSet,
+		"crypt_token_assign_keyslot":         b.tokenAssignKeyslot,
+		"crypt_token_unassign_keyslot":       b.tokenUnassignKeyslot,
+		"crypt_token_is_assigned":            b.tokenIsAssigned,
+		"crypt_token_status":                 b.tokenStatus,
+		"crypt_set_log_callback":             b.setLogCallback,
+		"crypt_log":                          b.log,
+		"crypt_set_confirm_callback":         func(*crypt.CryptDevice, uintptr, unsafe.Pointer) {},
+		"crypt_token_register":               b.tokenRegister,
+		"crypt_token_max":                    b.tokenMax,
+		"crypt_token_external_disable":       func() {},
+		"crypt_token_external_path":          func() *byte { return nil },
+		"crypt_set_label":                    b.setLabel,
+		"crypt_get_label":                    b.getLabel,
+		"crypt_get_subsystem":                b.getSubsystem,
+		"crypt_set_uuid":                     b.setUUID,
+		"crypt_get_cipher":                   b.getCipher,
+		"crypt_get_cipher_mode":              b.getCipherMode,
+		"crypt_get_sector_size":              b.getSectorSize,
+		"crypt_get_integrity_info":           b.getIntegrityInfo,
+		"crypt_header_is_detached":           b.headerIsDetached,
+	}
+}
+
+func (b *Backend) init(cd **crypt.CryptDevice, device *byte) int32 {
+	path := strings.GoString(device)
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, ok := b.disks[path]; !ok {
+		return errNOTBLK
+	}
+	*cd = b.newHandle(&handle{path: path})
+	return 0
+}
+
+func (b *Backend) initByName(cd **crypt.CryptDevice, name *byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	active, ok := b.active[strings.GoString(name)]
+	if !ok {
+		return errNODEV
+	}
+	*cd = b.newHandle(&handle{path: active.path, header: active.header, volumeKey: active.header.volumeKey})
+	return 0
+}
+
+// newHandle registers h and returns the pointer identifying it.
+// The pointer is never freed, so a freed context cannot be confused with a new one.
+func (b *Backend) newHandle(h *handle) *crypt.CryptDevice {
+	cd := (*crypt.CryptDevice)(libc.Malloc(1))
+	h.cStrings = map[string]*byte{}
+	b.handles[cd] = h
+	return cd
+}
+
+func (b *Backend) free(cd *crypt.CryptDevice) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if h, ok := b.handles[cd]; ok {
+		for _, cString := range h.cStrings {
+			strings.CFree(cString)
+		}
+		delete(b.handles, cd)
+	}
+}
+
+func (b *Backend) dump(cd *crypt.CryptDevice) int32 {
+	b.mux.Lock()
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil {
+		b.mux.Unlock()
+		return errINVAL
+	}
+	dump := h.header.String()
+	b.mux.Unlock()
+
+	h.logMessage(logNormal, dump)
+	return 0
+}
+
+func (b *Backend) setLogCallback(cd *crypt.CryptDevice, log unsafe.Pointer, usrptr unsafe.Pointer) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if h, ok := b.handles[cd]; ok {
+		h.log, h.logUsrptr = log, usrptr
+	}
+}
+
+func (b *Backend) log(cd *crypt.CryptDevice, level int32, msg *byte) {
+	b.mux.Lock()
+	h, ok := b.handles[cd]
+	b.mux.Unlock()
+
+	if ok {
+		h.logMessage(level, strings.GoString(msg))
+	}
+}
+
+func (b *Backend) getType(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil {
+		return nil
+	}
+	return h.cString("type", h.header.deviceType)
+}
+
+func (b *Backend) format(cd *crypt.CryptDevice, deviceType, cipher, cipherMode, uuid, volumeKey *byte, volumeKeySize uint64, params unsafe.Pointer) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header != nil || volumeKeySize == 0 {
+		return errINVAL
+	}
+	d, ok := b.disks[h.path]
+	if !ok {
+		return errNOTBLK
+	}
+
+	hdr := &header{
+		deviceType: strings.GoString(deviceType),
+		cipher:     strings.GoString(cipher),
+		cipherMode: strings.GoString(cipherMode),
+		uuid:       strings.GoString(uuid),
+		keyslots:   map[int][]byte{},
+		tokens:     map[int]string{},
+	}
+	switch hdr.deviceType {
+	case typeLUKS1, typePlain:
+	case typeLUKS2:
+		if params != nil {
+			luks2 := (*crypt.ParamsLUKS2)(params)
+			hdr.label = strings.GoString(luks2.Label)
+			hdr.subsystem = strings.GoString(luks2.Subsystem)
+		}
+	default:
+		return errINVAL
+	}
+
+	if volumeKey != nil {
+		hdr.volumeKey = strings.GoBytes(volumeKey, volumeKeySize)
+	} else {
+		hdr.volumeKey = make([]byte, volumeKeySize)
+		if _, err := rand.Read(hdr.volumeKey); err != nil {
+			return errNOMEM
+		}
+	}
+	if hdr.uuid == "" && hdr.deviceType != typePlain {
+		hdr.uuid = newUUID()
+	}
+
+	h.header, h.volumeKey = hdr, hdr.volumeKey
+	// Plain devices have no on-disk header.
+	if hdr.deviceType != typePlain {
+		d.header = hdr
+	}
+	return 0
+}
+
+// wipe reports the whole length as wiped at once, nothing is written.
+func (b *Backend) wipe(cd *crypt.CryptDevice, devPath *byte, pattern uint32, offset, length, wipeBlockSize uint64, flags uint32, progress uintptr, usrptr unsafe.Pointer) int32 {
+	b.mux.Lock()
+	_, ok := b.handles[cd]
+	b.mux.Unlock()
+	if !ok {
+		return errINVAL
+	}
+
+	if progress != 0 {
+		var progressFunc func(uint64, uint64, unsafe.Pointer) int32
+		crypt.RegisterFunc(&progressFunc, progress)
+		// libcryptsetup reports aborted wipes as -EINVAL.
+		if progressFunc(length, length, usrptr) != 0 {
+			return errINVAL
+		}
+	}
+	return 0
+}
+
+func (b *Backend) resize(cd *crypt.CryptDevice, name *byte, newSize uint64) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, ok := b.active[strings.GoString(name)]; !ok {
+		return errNODEV
+	}
+	return 0
+}
+
+func (b *Backend) load(cd *crypt.CryptDevice, requestedType *byte, params unsafe.Pointer) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok {
+		return errINVAL
+	}
+	d, ok := b.disks[h.path]
+	if !ok {
+		return errNOTBLK
+	}
+	hdr := d.header
+	if hdr == nil {
+		return errINVAL
+	}
+	if requestedType != nil && strings.GoString(requestedType) != hdr.deviceType {
+		return errINVAL
+	}
+	h.header = hdr
+	return 0
+}
+
+func (b *Backend) keyslotAddByVolumeKey(cd *crypt.CryptDevice, keyslot uint32, volumeKey *byte, volumeKeySize uint64, passphrase *byte, passphraseSize uint64) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luksHandle(cd)
+	if res < 0 {
+		return res
+	}
+	if volumeKey != nil {
+		if !bytes.Equal(strings.GoBytes(volumeKey, volumeKeySize), h.header.volumeKey) {
+			return errPERM
+		}
+	} else if h.volumeKey == nil {
+		return errINVAL
+	}
+	return h.header.addKeyslot(int32(keyslot), strings.GoBytes(passphrase, passphraseSize))
+}
+
+func (b *Backend) keyslotAddByPassphrase(cd *crypt.CryptDevice, keyslot uint32, passphrase *byte, passphraseSize uint64, newPassphrase *byte, newPassphraseSize uint64) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luksHandle(cd)
+	if res < 0 {
+		return res
+	}
+	if res := h.header.unlock(anySlot, strings.GoBytes(passphrase, passphraseSize)); res < 0 {
+		return res
+	}
+	return h.header.addKeyslot(int32(keyslot), strings.GoBytes(newPassphrase, newPassphraseSize))
+}
+
+func (b *Backend) keyslotChangeByPassphrase(cd *crypt.CryptDevice, keyslotOld, keyslotNew uint32, passphrase *byte, passphraseSize uint64, newPassphrase *byte, newPassphraseSize uint64) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luksHandle(cd)
+	if res < 0 {
+		return res
+	}
+	old := h.header.unlock(int32(keyslotOld), strings.GoBytes(passphrase, passphraseSize))
+	if old < 0 {
+		return old
+	}
+
+	target := int32(keyslotNew)
+	if target == anySlot || target == old {
+		target = old
+	} else if _, ok := h.header.keyslots[int(target)]; ok {
+		return errINVAL
+	}
+	delete(h.header.keyslots, int(old))
+	return h.header.addKeyslot(target, strings.GoBytes(newPassphrase, newPassphraseSize))
+}
+
+func (b *Backend) activateByPassphrase(cd *crypt.CryptDevice, name *byte, keyslot uint32, passphrase *byte, passphraseSize uint64, flags uint32) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luksHandle(cd)
+	if res < 0 {
+		return res
+	}
+	keyslotRes := h.header.unlock(int32(keyslot), strings.GoBytes(passphrase, passphraseSize))
+	if keyslotRes < 0 {
+		return keyslotRes
+	}
+	if res := b.activate(h, name, flags); res < 0 {
+		return res
+	}
+	return keyslotRes
+}
+
+func (b *Backend) activateByToken(cd *crypt.CryptDevice, name *byte, token uint32, usrptr unsafe.Pointer, flags uint32) int32 {
+	return b.activateByTokenType(cd, name, "", int32(token), nil, usrptr, flags)
+}
+
+func (b *Backend) activateByTokenPIN(cd *crypt.CryptDevice, name, tokenType *byte, token int32, pin *byte, pinSize uint64, usrptr unsafe.Pointer, flags uint32) int32 {
+	var pinBytes []byte
+	if pin != nil {
+		pinBytes = strings.GoBytes(pin, pinSize)
+	}
+	return b.activateByTokenType(cd, name, strings.GoString(tokenType), token, pinBytes, usrptr, flags)
+}
+
+// activateByTokenType unlocks the keyslots assigned to token, or to any token if token is anyToken,
+// with the passphrase returned by the token handler. Only tokens of tokenType are considered if it is set.
+// Tokens with a "fake-pin" are skipped with -ENOANO unless pin matches it.
+// The lock is released while token handlers run, as they call back into the fake.
+func (b *Backend) activateByTokenType(cd *crypt.CryptDevice, name *byte, tokenType string, token int32, pin []byte, usrptr unsafe.Pointer, flags uint32) int32 {
+	b.mux.Lock()
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		b.mux.Unlock()
+		return res
+	}
+	candidates := []int{int(token)}
+	if token == anyToken {
+		candidates = candidates[:0]
+		for id := 0; id < maxTokens; id++ {
+			candidates = append(candidates, id)
+		}
+	}
+	b.mux.Unlock()
+
+	res = errNOENT
+	for _, id := range candidates {
+		b.mux.Lock()
+		typ, keyslots, ok := h.header.token(id)
+		requiredPIN, hasPIN := h.header.tokenPIN(id)
+		handler := b.handlers[typ]
+		b.mux.Unlock()
+		if !ok || handler == nil || (tokenType != "" && typ != tokenType) {
+			continue
+		}
+		if hasPIN && !bytes.Equal(pin, requiredPIN) {
+			res = errNOANO
+			continue
+		}
+
+		passphrase, openRes := openToken(handler, cd, id, usrptr)
+		if openRes < 0 {
+			res = openRes
+			continue
+		}
+
+		b.mux.Lock()
+		res = errPERM
+		for _, keyslot := range keyslots {
+			if h.header.unlock(int32(keyslot), passphrase) < 0 {
+				continue
+			}
+			if res = b.activate(h, name, flags); res == 0 {
+				res = int32(keyslot)
+			}
+			break
+		}
+		b.mux.Unlock()
+		if res >= 0 {
+			return res
+		}
+	}
+	return res
+}
+
+func (b *Backend) activateByVolumeKey(cd *crypt.CryptDevice, name, volumeKey *byte, volumeKeySize uint64, flags uint32) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil {
+		return errINVAL
+	}
+	if volumeKey != nil {
+		if !bytes.Equal(strings.GoBytes(volumeKey, volumeKeySize), h.header.volumeKey) {
+			return errPERM
+		}
+	} else if h.volumeKey == nil {
+		return errINVAL
+	}
+	return b.activate(h, name, flags)
+}
+
+// activate adds an active device for h, or replaces the flags of an active device with CRYPT_ACTIVATE_REFRESH, unless name is nil.
+func (b *Backend) activate(h *handle, name *byte, flags uint32) int32 {
+	if name == nil {
+		return 0
+	}
+	activeName := strings.GoString(name)
+	const refresh, inputOnly = 0x40000, 0x40000 | 0x4000 // CRYPT_ACTIVATE_REFRESH, CRYPT_ACTIVATE_IGNORE_PERSISTENT
+	if m, ok := b.active[activeName]; ok {
+		if flags&refresh == 0 || m.path != h.path {
+			return errEXIST
+		}
+		m.flags = flags &^ inputOnly
+		return 0
+	} else if flags&refresh != 0 {
+		return errNODEV
+	}
+	b.active[activeName] = &mapping{path: h.path, header: h.header, flags: flags &^ inputOnly}
+	return 0
+}
+
+func (b *Backend) deactivate(cd *crypt.CryptDevice, name *byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	activeName := strings.GoString(name)
+	if _, ok := b.active[activeName]; !ok {
+		return errNODEV
+	}
+	delete(b.active, activeName)
+	return 0
+}
+
+// deactivateByName deactivates like deactivate, as devices of the fake are never in use,
+// so CRYPT_DEACTIVATE_DEFERRED and CRYPT_DEACTIVATE_FORCE take effect immediately.
+// For the same reason, no removal is ever pending and CRYPT_DEACTIVATE_DEFERRED_CANCEL leaves the device active.
+func (b *Backend) deactivateByName(cd *crypt.CryptDevice, name *byte, flags uint32) int32 {
+	const deferred, force, deferredCancel = 0x1, 0x2, 0x4 // CRYPT_DEACTIVATE_*
+	if flags&^(deferred|force|deferredCancel) != 0 {
+		return errNOTSUP
+	}
+	if flags&deferredCancel == 0 {
+		return b.deactivate(cd, name)
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, ok := b.active[strings.GoString(name)]; !ok {
+		return errNODEV
+	}
+	return 0
+}
+
+func (b *Backend) status(cd *crypt.CryptDevice, name *byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, ok := b.active[strings.GoString(name)]; !ok {
+		return 1 // CRYPT_INACTIVE
+	}
+	return 2 // CRYPT_ACTIVE
+}
+
+func (b *Backend) getActiveDevice(cd *crypt.CryptDevice, name *byte, cad *crypt.ActiveDevice) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	m, ok := b.active[strings.GoString(name)]
+	if !ok {
+		return errNODEV
+	}
+	*cad = crypt.ActiveDevice{Flags: m.flags}
+	if d, ok := b.disks[m.path]; ok {
+		cad.Size = d.size / 512
+	}
+	return 0
+}
+
+func (b *Backend) getVolumeKeySize(cd *crypt.CryptDevice) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil {
+		return 0
+	}
+	return int32(len(h.header.volumeKey))
+}
+
+func (b *Backend) volumeKeyGet(cd *crypt.CryptDevice, keyslot int32, volumeKey *byte, volumeKeySize *uint64, passphrase *byte, passphraseSize uint64) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luksHandle(cd)
+	if res < 0 {
+		return res
+	}
+	res = h.header.unlock(keyslot, strings.GoBytes(passphrase, passphraseSize))
+	if res < 0 {
+		return res
+	}
+	if *volumeKeySize < uint64(len(h.header.volumeKey)) {
+		return errINVAL
+	}
+	*volumeKeySize = uint64(len(h.header.volumeKey))
+	libc.Memcpy(unsafe.Pointer(volumeKey), unsafe.Pointer(&h.header.volumeKey[0]), *volumeKeySize)
+	return res
+}
+
+func (b *Backend) getDeviceName(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok {
+		return nil
+	}
+	return h.cString("device", h.path)
+}
+
+func (b *Backend) getUUID(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil || h.header.uuid == "" {
+		return nil
+	}
+	return h.cString("uuid", h.header.uuid)
+}
+
+func (b *Backend) tokenJSONGet(cd *crypt.CryptDevice, token uint32, json **byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return res
+	}
+	tokenJSON, ok := h.header.tokens[int(token)]
+	if !ok {
+		return errNOENT
+	}
+	*json = h.cString("token", tokenJSON)
+	return int32(token)
+}
+
+func (b *Backend) tokenJSONSet(cd *crypt.CryptDevice, token uint32, json *byte) int32 {
+	b.mux.Lock()
+	h, res := b.luks2Handle(cd)
+	b.mux.Unlock()
+	if res < 0 {
+		return res
+	}
+	if json == nil {
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		if _, ok := h.header.tokens[int(token)]; !ok {
+			return errINVAL
+		}
+		delete(h.header.tokens, int(token))
+		return int32(token)
+	}
+
+	tokenJSON := strings.GoString(json)
+	typ, keyslots, ok := parseToken(tokenJSON)
+	if !ok {
+		return errINVAL
+	}
+
+	b.mux.Lock()
+	handler := b.handlers[typ]
+	b.mux.Unlock()
+	if handler != nil && handler.Validate != 0 {
+		var validate func(*crypt.CryptDevice, *byte) int32
+		crypt.RegisterFunc(&validate, handler.Validate)
+		if res := validate(cd, json); res < 0 {
+			return res
+		}
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, keyslot := range keyslots {
+		if _, ok := h.header.keyslots[keyslot]; !ok {
+			return errINVAL
+		}
+	}
+	id := int(int32(token))
+	if id == anyToken {
+		for id = 0; id < maxTokens; id++ {
+			if _, ok := h.header.tokens[id]; !ok {
+				break
+			}
+		}
+	}
+	if id < 0 || id >= maxTokens {
+		return errINVAL
+	}
+	h.header.tokens[id] = tokenJSON
+	return int32(id)
+}
+
+func (b *Backend) tokenLUKS2KeyringGet(cd *crypt.CryptDevice, token uint32, params *crypt.TokenParamsLUKS2Keyring) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return res
+	}
+	var keyring struct {
+		Type           string `json:"type"`
+		KeyDescription string `json:"key_description"`
+	}
+	tokenJSON, ok := h.header.tokens[int(token)]
+	if !ok {
+		return errNOENT
+	}
+	if err := json.Unmarshal([]byte(tokenJSON), &keyring); err != nil || keyring.Type != keyringTok {
+		return errINVAL
+	}
+	params.KeyDescription = h.cString("key_description", keyring.KeyDescription)
+	return int32(token)
+}
+
+func (b *Backend) tokenLUKS2KeyringSet(cd *crypt.CryptDevice, token uint32, params *crypt.TokenParamsLUKS2Keyring) int32 {
+	tokenJSON, err := json.Marshal(map[string]any{
+		"type":            keyringTok,
+		"keyslots":        []string{},
+		"key_description": strings.GoString(params.KeyDescription),
+	})
+	if err != nil {
+		return errINVAL
+	}
+	cJSON := strings.CString(string(tokenJSON))
+	defer strings.CFree(cJSON)
+	return b.tokenJSONSet(cd, token, cJSON)
+}
+
+func (b *Backend) tokenAssignKeyslot(cd *crypt.CryptDevice, token, keyslot uint32) int32 {
+	return b.tokenUpdateKeyslots(cd, int32(token), int32(keyslot), true)
+}
+
+func (b *Backend) tokenUnassignKeyslot(cd *crypt.CryptDevice, token, keyslot uint32) int32 {
+	return b.tokenUpdateKeyslots(cd, int32(token), int32(keyslot), false)
+}
+
+// tokenUpdateKeyslots assigns keyslot to token, or unassigns it if assign is false.
+// token and keyslot may be anyToken and anySlot to update all tokens or keyslots.
+func (b *Backend) tokenUpdateKeyslots(cd *crypt.CryptDevice, token, keyslot int32, assign bool) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return res
+	}
+
+	tokens := []int{int(token)}
+	if token == anyToken {
+		tokens = h.header.sortedTokens()
+	} else if _, ok := h.header.tokens[int(token)]; !ok {
+		return errINVAL
+	}
+	keyslots := []int{int(keyslot)}
+	if keyslot == anySlot {
+		keyslots = h.header.sortedKeyslots()
+	} else if _, ok := h.header.keyslots[int(keyslot)]; !ok {
+		return errINVAL
+	}
+
+	for _, id := range tokens {
+		var tokenJSON map[string]any
+		if err := json.Unmarshal([]byte(h.header.tokens[id]), &tokenJSON); err != nil {
+			return errINVAL
+		}
+		_, assigned, _ := parseToken(h.header.tokens[id])
+		updated := make([]string, 0, len(assigned)+len(keyslots))
+		for _, slot := range assigned {
+			if assign || !containsInt(keyslots, slot) {
+				updated = append(updated, strconv.Itoa(slot))
+			}
+		}
+		if assign {
+			for _, slot := range keyslots {
+				if !containsInt(assigned, slot) {
+					updated = append(updated, strconv.Itoa(slot))
+				}
+			}
+		}
+		tokenJSON["keyslots"] = updated
+		encoded, err := json.Marshal(tokenJSON)
+		if err != nil {
+			return errINVAL
+		}
+		h.header.tokens[id] = string(encoded)
+	}
+	return token
+}
+
+func (b *Backend) tokenIsAssigned(cd *crypt.CryptDevice, token, keyslot uint32) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return res
+	}
+	if _, ok := h.header.keyslots[int(keyslot)]; !ok {
+		return errINVAL
+	}
+	_, keyslots, ok := h.header.token(int(token))
+	if !ok {
+		return errINVAL
+	}
+	if !containsInt(keyslots, int(keyslot)) {
+		return errNOENT
+	}
+	return 0
+}
+
+func (b *Backend) tokenStatus(cd *crypt.CryptDevice, token uint32, tokenType **byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 || int32(token) < 0 || token >= maxTokens {
+		return tokenInvalid
+	}
+	typ, _, ok := h.header.token(int(token))
+	if !ok {
+		return tokenInactive
+	}
+	if tokenType != nil {
+		*tokenType = h.cString("token_type", typ)
+	}
+	switch {
+	case typ == keyringTok:
+		return tokenInternal
+	case gostrings.HasPrefix(typ, "luks2-"):
+		return tokenInternalUnknown
+	case b.handlers[typ] != nil:
+		return tokenExternal
+	default:
+		return tokenExternalUnknown
+	}
+}
+
+func (b *Backend) tokenRegister(handler *crypt.TokenHandler) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	name := strings.GoString(handler.Name)
+	if name == "" || gostrings.HasPrefix(name, "luks2-") || b.handlers[name] != nil {
+		return errINVAL
+	}
+	b.handlers[name] = handler
+	return 0
+}
+
+func (b *Backend) tokenMax(deviceType *byte) int32 {
+	if strings.GoString(deviceType) != typeLUKS2 {
+		return errINVAL
+	}
+	return maxTokens
+}
+
+func (b *Backend) setLabel(cd *crypt.CryptDevice, label, subsystem *byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return res
+	}
+	h.header.label, h.header.subsystem = strings.GoString(label), strings.GoString(subsystem)
+	return 0
+}
+
+func (b *Backend) getLabel(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return nil
+	}
+	return h.cString("label", h.header.label)
+}
+
+func (b *Backend) getSubsystem(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luks2Handle(cd)
+	if res < 0 {
+		return nil
+	}
+	return h.cString("subsystem", h.header.subsystem)
+}
+
+func (b *Backend) setUUID(cd *crypt.CryptDevice, uuid *byte) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, res := b.luksHandle(cd)
+	if res < 0 {
+		return res
+	}
+	if uuid == nil {
+		h.header.uuid = newUUID()
+		return 0
+	}
+	value := strings.GoString(uuid)
+	if len(value) != 36 || gostrings.Count(value, "-") != 4 {
+		return errINVAL
+	}
+	h.header.uuid = value
+	return 0
+}
+
+// luksHandle returns the context of cd if it has a LUKS header.
+func (b *Backend) luksHandle(cd *crypt.CryptDevice) (*handle, int32) {
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil || h.header.deviceType == typePlain {
+		return nil, errINVAL
+	}
+	return h, 0
+}
+
+// luks2Handle returns the context of cd if it has a LUKS2 header.
+func (b *Backend) luks2Handle(cd *crypt.CryptDevice) (*handle, int32) {
+	h, res := b.luksHandle(cd)
+	if res < 0 || h.header.deviceType != typeLUKS2 {
+		return nil, errINVAL
+	}
+	return h, 0
+}
+
+// openToken calls the open function of a registered token handler and returns a copy of the passphrase.
+func openToken(handler *crypt.TokenHandler, cd *crypt.CryptDevice, token int, usrptr unsafe.Pointer) ([]byte, int32) {
+	var open func(*crypt.CryptDevice, int32, **byte, *uint64, unsafe.Pointer) int32
+	crypt.RegisterFunc(&open, handler.Open)
+
+	var buffer *byte
+	var bufferLen uint64
+	if res := open(cd, int32(token), &buffer, &bufferLen, usrptr); res < 0 {
+		return nil, res
+	}
+	passphrase := strings.GoBytes(buffer, bufferLen)
+
+	if handler.BufferFree != 0 {
+		var bufferFree func(unsafe.Pointer, uint64)
+		crypt.RegisterFunc(&bufferFree, handler.BufferFree)
+		bufferFree(unsafe.Pointer(buffer), bufferLen)
+	} else {
+		libc.Free(unsafe.Pointer(buffer))
+	}
+	return passphrase, 0
+}
+
+// addKeyslot stores passphrase in keyslot, or in the first free keyslot if keyslot is anySlot.
+func (h *header) addKeyslot(keyslot int32, passphrase []byte) int32 {
+	max := int32(8)
+	if h.deviceType == typeLUKS2 {
+		max = 32
+	}
+	if keyslot == anySlot {
+		for keyslot = 0; keyslot < max; keyslot++ {
+			if _, ok := h.keyslots[int(keyslot)]; !ok {
+				break
+			}
+		}
+	}
+	if keyslot < 0 || keyslot >= max {
+		return errINVAL
+	}
+	if _, ok := h.keyslots[int(keyslot)]; ok {
+		return errINVAL
+	}
+	h.keyslots[int(keyslot)] = passphrase
+	return keyslot
+}
+
+// unlock returns the keyslot opened by passphrase.
+// If keyslot is anySlot, all keyslots are tried in order.
+func (h *header) unlock(keyslot int32, passphrase []byte) int32 {
+	if keyslot == anySlot {
+		for _, slot := range h.sortedKeyslots() {
+			if bytes.Equal(h.keyslots[slot], passphrase) {
+				return int32(slot)
+			}
+		}
+		return errPERM
+	}
+	stored, ok := h.keyslots[int(keyslot)]
+	if !ok {
+		return errNOENT
+	}
+	if !bytes.Equal(stored, passphrase) {
+		return errPERM
+	}
+	return keyslot
+}
+
+// token returns the type and assigned keyslots of token.
+func (h *header) token(token int) (string, []int, bool) {
+	tokenJSON, ok := h.tokens[token]
+	if !ok {
+		return "", nil, false
+	}
+	return parseToken(tokenJSON)
+}
+
+// tokenPIN returns the PIN protecting a token, which is configured in its "fake-pin" field.
+func (h *header) tokenPIN(token int) ([]byte, bool) {
+	var fields struct {
+		PIN *string `json:"fake-pin"`
+	}
+	if err := json.Unmarshal([]byte(h.tokens[token]), &fields); err != nil || fields.PIN == nil {
+		return nil, false
+	}
+	return []byte(*fields.PIN), true
+}
+
+func (h *header) sortedKeyslots() []int {
+	keyslots := make([]int, 0, len(h.keyslots))
+	for slot := 0; slot < 32; slot++ {
+		if _, ok := h.keyslots[slot]; ok {
+			keyslots = append(keyslots, slot)
+		}
+	}
+	return keyslots
+}
+
+func (h *header) sortedTokens() []int {
+	tokens := make([]int, 0, len(h.tokens))
+	for id := 0; id < maxTokens; id++ {
+		if _, ok := h.tokens[id]; ok {
+			tokens = append(tokens, id)
+		}
+	}
+	return tokens
+}
+
+// parseToken validates a token JSON definition like libcryptsetup does
+// and returns its type and assigned keyslots.
+func parseToken(tokenJSON string) (string, []int, bool) {
+	var token struct {
+		Type     *string  `json:"type"`
+		Keyslots []string `json:"keyslots"`
+	}
+	if err := json.Unmarshal([]byte(tokenJSON), &token); err != nil || token.Type == nil || token.Keyslots == nil {
+		return "", nil, false
+	}
+	keyslots := make([]int, 0, len(token.Keyslots))
+	for _, keyslot := range token.Keyslots {
+		slot, err := strconv.Atoi(keyslot)
+		if err != nil {
+			return "", nil, false
+		}
+		keyslots = append(keyslots, slot)
+	}
+	return *token.Type, keyslots, true
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() string {
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[:])
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+func (b *Backend) getCipher(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil {
+		return nil
+	}
+	return h.cString("cipher", h.header.cipher)
+}
+
+func (b *Backend) getCipherMode(cd *crypt.CryptDevice) *byte {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	h, ok := b.handles[cd]
+	if !ok || h.header == nil {
+		return nil
+	}
+	return h.cString("cipherMode", h.header.cipherMode)
+}
+
+func (b *Backend) getSectorSize(cd *crypt.CryptDevice) int32 {
+	return 512
+}
+
+func (b *Backend) getIntegrityInfo(cd *crypt.CryptDevice, ip *crypt.ParamsIntegrity) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, res := b.luks2Handle(cd); res < 0 {
+		return res
+	}
+	*ip = crypt.ParamsIntegrity{}
+	return 0
+}
+
+func (b *Backend) headerIsDetached(cd *crypt.CryptDevice) int32 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, res := b.luksHandle(cd); res < 0 {
+		return res
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package cryptsetupfake
+
+import (
+	"testing"
+
+	cryptsetup "github.com/malt3/purego-cryptsetup"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// TestDeactivateByNameFlags calls the fake directly, as package cryptsetup rejects
+// CRYPT_DEACTIVATE_DEFERRED_CANCEL for the emulated libcryptsetup version.
+func TestDeactivateByNameFlags(test *testing.T) {
+	// Loads libc for the C strings.
+	if _, err := cryptsetup.Open(cryptsetup.LibraryOptions{}); err != nil {
+		test.Fatal(err)
+	}
+	b := &Backend{active: map[string]*mapping{"fakeFlags": {}}}
+	name := strings.CString("fakeFlags")
+	defer strings.CFree(name)
+
+	if res := b.deactivateByName(nil, name, 0x8); res != errNOTSUP {
+		test.Errorf("expected %d for an unknown flag, got %d", errNOTSUP, res)
+	}
+	if res := b.deactivateByName(nil, name, 0x4); res != 0 {
+		test.Errorf("expected cancelling to succeed, got %d", res)
+	}
+	if _, ok := b.active["fakeFlags"]; !ok {
+		test.Fatal("cancelling a deferred removal should leave the device active")
+	}
+
+	if res := b.deactivateByName(nil, name, 0x1|0x2); res != 0 {
+		test.Errorf("expected deactivation to succeed, got %d", res)
+	}
+	if res := b.deactivateByName(nil, name, 0x4); res != errNODEV {
+		test.Errorf("expected %d cancelling for an inactive device, got %d", errNODEV, res)
+	}
+}
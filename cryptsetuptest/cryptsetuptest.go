@@ -0,0 +1,136 @@
+// Package cryptsetuptest provides fixtures for integration tests against libcryptsetup.
+//
+// Fixtures create loop devices backed by sparse files and release everything they
+// created, including device-mapper mappings activated on top of them, via t.Cleanup.
+// They require root privileges and are skipped otherwise.
+package cryptsetuptest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cryptsetup "github.com/malt3/purego-cryptsetup"
+	"github.com/malt3/purego-cryptsetup/loop"
+)
+
+// DefaultSize is the size in bytes of loop devices created by Format.
+const DefaultSize = 64 << 20
+
+// LoopDevice is a loop device backed by a sparse file.
+type LoopDevice struct {
+	// BackingFile is the path of the sparse file backing the loop device.
+	BackingFile string
+	// Path is the path of the loop device, e.g. /dev/loop0.
+	Path string
+
+	loop *loop.Device
+}
+
+// NewLoopDevice creates a sparse file of size bytes and attaches it to a free loop device.
+// On cleanup, mappings activated on the loop device are deactivated and the loop device is detached.
+func NewLoopDevice(t testing.TB, size int64) *LoopDevice {
+	t.Helper()
+	RequireRoot(t)
+
+	backingFile := filepath.Join(t.TempDir(), "backing.img")
+	file, err := os.Create(backingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Truncate(size)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loopDevice, err := loop.Attach(backingFile, loop.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := &LoopDevice{BackingFile: backingFile, Path: loopDevice.Path(), loop: loopDevice}
+	t.Cleanup(func() { device.teardown(t) })
+	return device
+}
+
+// Init initializes a crypt device on the loop device, which is freed on cleanup.
+func (device *LoopDevice) Init(t testing.TB) *cryptsetup.Device {
+	t.Helper()
+
+	cryptDevice, err := cryptsetup.Init(device.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cryptDevice.Free() })
+	return cryptDevice
+}
+
+// Mappings returns the names of the device-mapper devices stacked on the loop device.
+func (device *LoopDevice) Mappings() ([]string, error) {
+	holders, err := os.ReadDir(filepath.Join("/sys/block", filepath.Base(device.Path), "holders"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(holders))
+	for _, holder := range holders {
+		name, err := os.ReadFile(filepath.Join("/sys/block", holder.Name(), "dm", "name"))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, strings.TrimSpace(string(name)))
+	}
+	return names, nil
+}
+
+// teardown deactivates all mappings on the loop device and detaches it.
+func (device *LoopDevice) teardown(t testing.TB) {
+	t.Helper()
+
+	names, err := device.Mappings()
+	if err != nil {
+		t.Errorf("listing mappings of %s: %v", device.Path, err)
+	}
+	for _, name := range names {
+		if err := deactivate(name); err != nil {
+			t.Errorf("deactivating %s: %v", name, err)
+		}
+	}
+	if err := device.loop.Detach(); err != nil {
+		t.Errorf("detaching %s: %v", device.Path, err)
+	}
+}
+
+// Format creates a loop device of DefaultSize and formats it with deviceType and genericParams.
+// The returned Device is freed and the loop device released on cleanup.
+func Format(t testing.TB, deviceType cryptsetup.DeviceType, genericParams cryptsetup.GenericParams) (*LoopDevice, *cryptsetup.Device) {
+	t.Helper()
+
+	device := NewLoopDevice(t, DefaultSize)
+	cryptDevice := device.Init(t)
+	if err := cryptDevice.Format(deviceType, genericParams); err != nil {
+		t.Fatal(err)
+	}
+	return device, cryptDevice
+}
+
+// RequireRoot skips the test unless it runs with root privileges,
+// which libcryptsetup needs for loop and device-mapper devices.
+func RequireRoot(t testing.TB) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("requires root privileges")
+	}
+}
+
+func deactivate(name string) error {
+	cryptDevice, err := cryptsetup.InitByName(name)
+	if err != nil {
+		return err
+	}
+	defer cryptDevice.Free()
+	return cryptDevice.Deactivate(name)
+}
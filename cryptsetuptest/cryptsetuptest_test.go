@@ -0,0 +1,62 @@
+package cryptsetuptest_test
+
+import (
+	"os"
+	"testing"
+
+	cryptsetup "github.com/malt3/purego-cryptsetup"
+	"github.com/malt3/purego-cryptsetup/cryptsetuptest"
+)
+
+func TestNewLoopDevice(t *testing.T) {
+	var device *cryptsetuptest.LoopDevice
+	t.Run("attach", func(t *testing.T) {
+		device = cryptsetuptest.NewLoopDevice(t, 16<<20)
+
+		info, err := os.Stat(device.BackingFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 16<<20 {
+			t.Errorf("unexpected backing file size %d", info.Size())
+		}
+		if _, err := os.Stat("/sys/block/" + device.Path[len("/dev/"):] + "/loop/backing_file"); err != nil {
+			t.Errorf("%s is not attached: %v", device.Path, err)
+		}
+		mappings, err := device.Mappings()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mappings) != 0 {
+			t.Errorf("unexpected mappings %v", mappings)
+		}
+	})
+
+	if device == nil {
+		return
+	}
+	if _, err := os.Stat("/sys/block/" + device.Path[len("/dev/"):] + "/loop/backing_file"); err == nil {
+		t.Errorf("%s should have been detached", device.Path)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	device, cryptDevice := cryptsetuptest.Format(t,
+		cryptsetup.LUKS2{SectorSize: 512, PBKDFType: &cryptsetup.PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: cryptsetup.CRYPT_PBKDF_NO_BENCHMARK}},
+		cryptsetup.GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8},
+	)
+	if cryptDevice.Type() != cryptsetup.CRYPT_LUKS2 {
+		t.Errorf("unexpected type %q", cryptDevice.Type())
+	}
+	if err := cryptDevice.KeyslotAddByVolumeKey(0, "", "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := device.Init(t)
+	if err := loaded.Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetUUID() != cryptDevice.GetUUID() {
+		t.Errorf("loaded UUID %q differs from %q", loaded.GetUUID(), cryptDevice.GetUUID())
+	}
+}
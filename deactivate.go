@@ -0,0 +1,93 @@
+package cryptsetup
+
+import (
+	"fmt"
+
+	"github.com/malt3/purego-cryptsetup/internal/devmapper"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// DeactivateByName deactivates a device with flags, a combination of CRYPT_DEACTIVATE_* flags.
+// CRYPT_DEACTIVATE_DEFERRED removes a busy device once its last user closes it,
+// CRYPT_DEACTIVATE_FORCE replaces a busy device with an error device.
+// CRYPT_DEACTIVATE_DEFERRED_CANCEL needs libcryptsetup 2.6, as older versions would deactivate the device instead.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_deactivate_by_name
+func (device *Device) DeactivateByName(deviceName string, flags DeactivateFlags) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if flags.Has(DeactivateDeferredCancel) && !crypt.VersionAtLeast("2.6") {
+		return fmt.Errorf("CRYPT_DEACTIVATE_DEFERRED_CANCEL needs libcryptsetup 2.6: %w", ErrNotSupported)
+	}
+
+	cDeviceName := strings.CString(deviceName)
+	defer strings.CFree(cDeviceName)
+
+	if res := crypt.DeactivateByName(device.cryptDevice, cDeviceName, uint32(flags)); res < 0 {
+		return &Error{functionName: "crypt_deactivate_by_name", code: int(res)}
+	}
+	return nil
+}
+
+// CancelDeferredRemoval cancels a pending deferred deactivation of a device.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_deactivate_by_name with CRYPT_DEACTIVATE_DEFERRED_CANCEL
+func (device *Device) CancelDeferredRemoval(deviceName string) error {
+	return device.DeactivateByName(deviceName, CRYPT_DEACTIVATE_DEFERRED_CANCEL)
+}
+
+// ActiveDevice describes an active device.
+type ActiveDevice struct {
+	Status StatusInfo
+	// Offset is the offset of the data area in 512-byte sectors.
+	Offset   uint64
+	IVOffset uint64
+	// Size is the size of the device in 512-byte sectors.
+	Size  uint64
+	Flags ActivateFlags
+	// DeferredRemove is true if the device is removed once its last user closes it.
+	DeferredRemove bool
+}
+
+// Status gets the status of the device deviceName.
+// The other fields are only set if the device is CRYPT_ACTIVE or CRYPT_BUSY.
+// Returns the status on success, or an error otherwise.
+// C equivalent: crypt_status, crypt_get_active_device
+func (device *Device) Status(deviceName string) (ActiveDevice, error) {
+	if err := device.lock(); err != nil {
+		return ActiveDevice{}, err
+	}
+	defer device.mux.Unlock()
+
+	cDeviceName := strings.CString(deviceName)
+	defer strings.CFree(cDeviceName)
+
+	active := ActiveDevice{Status: StatusInfo(crypt.Status(device.cryptDevice, cDeviceName))}
+	if active.Status != CRYPT_ACTIVE && active.Status != CRYPT_BUSY {
+		return active, nil
+	}
+
+	var cActive crypt.ActiveDevice
+	if res := crypt.GetActiveDevice(device.cryptDevice, cDeviceName, &cActive); res < 0 {
+		return active, &Error{functionName: "crypt_get_active_device", code: int(res)}
+	}
+	active.Offset = cActive.Offset
+	active.IVOffset = cActive.IVOffset
+	active.Size = cActive.Size
+	active.Flags = ActivateFlags(cActive.Flags)
+
+	// libcryptsetup does not report a pending deferred removal, so device-mapper is asked directly.
+	// Devices of an installed fake do not exist in device-mapper.
+	if !crypt.Installed() {
+		deferredRemove, err := devmapper.DeferredRemove(deviceName)
+		if err != nil {
+			return active, err
+		}
+		active.DeferredRemove = deferredRemove
+	}
+	return active, nil
+}
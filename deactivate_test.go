@@ -0,0 +1,55 @@
+package cryptsetup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+)
+
+func Test_Device_Status_Inactive(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	status, err := device.Status(DeviceName)
+	testWrapper.AssertNoError(err)
+	if status.Status != CRYPT_INACTIVE && status.Status != CRYPT_INVALID {
+		test.Errorf("Expected %s to be inactive, got %+v", DeviceName, status)
+	}
+	if status.DeferredRemove || status.Size != 0 {
+		test.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func Test_Device_DeactivateByName_Fails_For_Inactive_Device(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	for _, flags := range []DeactivateFlags{0, DeactivateDeferred, DeactivateForce} {
+		err = device.DeactivateByName(DeviceName, flags)
+		testWrapper.AssertError(err)
+		if errors.Is(err, ErrNotSupported) {
+			test.Errorf("Unexpected error %v for flags %s", err, flags)
+		}
+	}
+}
+
+func Test_Device_CancelDeferredRemoval(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.CancelDeferredRemoval(DeviceName)
+	testWrapper.AssertError(err)
+	if supported := crypt.VersionAtLeast("2.6"); supported == errors.Is(err, ErrNotSupported) {
+		test.Errorf("Unexpected error %v for libcryptsetup %s", err, crypt.Version())
+	}
+}
@@ -1,21 +1,36 @@
 package cryptsetup
 
 import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
 	"github.com/malt3/purego-cryptsetup/internal/dlopen/libc"
 	"github.com/malt3/purego-cryptsetup/internal/strings"
+	"github.com/malt3/purego-cryptsetup/loop"
 )
 
 // Device is a handle to the crypto device.
 // It encapsulates libcryptsetup's 'crypt_device' struct.
+// A Device is safe for concurrent use; calls into libcryptsetup are serialized per Device.
+// Callbacks, like the progress function of Wipe, must not call methods of the same Device.
+// Methods called after Free or Close return ErrClosed.
 type Device struct {
+	mux         sync.Mutex
 	cryptDevice *crypt.CryptDevice
 	freed       bool
+	// loopDevice is the loop device attached by Init if it was given a regular file.
+	loopDevice  *loop.Device
+	backingFile string
 }
 
 // Init initializes a crypt device backed by 'devicePath'.
+// If 'devicePath' is a regular file, it is attached to an auto-clearing loop device,
+// which is released by Free once no active device uses it.
 // Returns a pointer to the newly allocated Device or any error encountered.
 // C equivalent: crypt_init
 func Init(devicePath string) (*Device, error) {
@@ -23,15 +38,40 @@ func Init(devicePath string) (*Device, error) {
 		return nil, err
 	}
 
+	device := &Device{}
+	if device.loopDevice = attachLoop(devicePath); device.loopDevice != nil {
+		device.backingFile = devicePath
+		devicePath = device.loopDevice.Path()
+	}
+
 	cryptDevicePath := strings.CString(devicePath)
 	defer strings.CFree(cryptDevicePath)
 
-	var cryptDevice *crypt.CryptDevice
-	if err := int(crypt.Init(&cryptDevice, cryptDevicePath)); err < 0 {
+	if err := int(crypt.Init(&device.cryptDevice, cryptDevicePath)); err < 0 {
+		if device.loopDevice != nil {
+			device.loopDevice.Close()
+		}
 		return nil, &Error{functionName: "crypt_init", code: err}
 	}
 
-	return &Device{cryptDevice: cryptDevice}, nil
+	runtime.SetFinalizer(device, finalizeDevice)
+	return device, nil
+}
+
+// attachLoop attaches devicePath to an auto-clearing loop device if it is a regular file.
+// Returns nil if devicePath is no regular file or no loop device can be attached,
+// e.g. without root privileges. libcryptsetup then handles the file itself.
+func attachLoop(devicePath string) *loop.Device {
+	info, err := os.Stat(devicePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	loopDevice, err := loop.Attach(devicePath, loop.Options{AutoClear: true})
+	if err != nil {
+		debugf("Cannot attach %s to a loop device, passing the file to libcryptsetup: %v", devicePath, err)
+		return nil
+	}
+	return loopDevice
 }
 
 // InitByName initializes a crypt device from provided active device 'name'.
@@ -50,35 +90,120 @@ func InitByName(name string) (*Device, error) {
 		return nil, &Error{functionName: "crypt_init_by_name", code: err}
 	}
 
-	return &Device{cryptDevice: cryptDevice}, nil
+	device := &Device{cryptDevice: cryptDevice}
+	runtime.SetFinalizer(device, finalizeDevice)
+	return device, nil
 }
 
 // Free releases crypt device context and used memory.
+// Returns false if the device has already been freed.
 // C equivalent: crypt_free
 func (device *Device) Free() bool {
-	if !device.freed {
-		crypt.Free(device.cryptDevice)
-		device.freed = true
-		return true
+	device.mux.Lock()
+	defer device.mux.Unlock()
+
+	if device.freed {
+		return false
+	}
+	forgetConfirmCallback(device.cryptDevice)
+	crypt.Free(device.cryptDevice)
+	if device.loopDevice != nil {
+		device.loopDevice.Close()
+	}
+	device.freed = true
+	runtime.SetFinalizer(device, nil)
+	return true
+}
+
+// Close releases crypt device context and used memory, like Free.
+// Returns ErrClosed if the device has already been freed.
+// C equivalent: crypt_free
+func (device *Device) Close() error {
+	if !device.Free() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// lock acquires the device for a call into libcryptsetup.
+// Returns ErrClosed, without holding the lock, if the device has been freed.
+func (device *Device) lock() error {
+	device.mux.Lock()
+	if device.freed {
+		device.mux.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// finalizeDevice frees devices that were never freed.
+func finalizeDevice(device *Device) {
+	debugf("Device %s was not freed, freeing it in finalizer", device.GetDeviceName())
+	device.Free()
+}
+
+// debugf prints a message of this package to stderr if debugging is enabled with SetDebugLevel.
+func debugf(format string, args ...any) {
+	if debugLevel.Load() != CRYPT_DEBUG_NONE {
+		fmt.Fprintf(os.Stderr, "cryptsetup: "+format+"\n", args...)
 	}
-	return false
 }
 
 // C equivalent: crypt_dump
 func (device *Device) Dump() int {
+	if device.lock() != nil {
+		return -22 // EINVAL
+	}
+	defer device.mux.Unlock()
+
 	return int(crypt.Dump(device.cryptDevice))
 }
 
 // Type returns the device's type as a string.
 // Returns an empty string if the information is not available.
 func (device *Device) Type() string {
+	if device.lock() != nil {
+		return ""
+	}
+	defer device.mux.Unlock()
+
 	return strings.GoString(crypt.GetType(device.cryptDevice))
 }
 
 // Format formats a Device, using a specific device type, and type-independent parameters.
+// Go strings are immutable, so only a temporary copy of genericParams.VolumeKey is wiped, not the string itself;
+// use FormatBytes to wipe the volume key.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_format
 func (device *Device) Format(deviceType DeviceType, genericParams GenericParams) error {
+	volumeKey := []byte(genericParams.VolumeKey)
+	defer WipeSecret(volumeKey)
+
+	return device.FormatBytes(deviceType, genericParams, volumeKey)
+}
+
+// FormatBytes formats a Device like Format, using volumeKey instead of genericParams.VolumeKey.
+// If volumeKey is empty, a volume key of genericParams.VolumeKeySize is read from genericParams.VolumeKeyReader,
+// or generated by libcryptsetup if it is nil.
+// The volume key is only copied to C memory for the duration of the call, and that copy is wiped.
+// The caller owns volumeKey and should WipeSecret it when done.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_format
+func (device *Device) FormatBytes(deviceType DeviceType, genericParams GenericParams, volumeKey []byte) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if len(volumeKey) == 0 && genericParams.VolumeKeyReader != nil {
+		generated, err := readVolumeKey(deviceType, genericParams)
+		if err != nil {
+			return err
+		}
+		defer WipeSecret(generated)
+		volumeKey = generated
+	}
+
 	cryptDeviceTypeName := strings.CString(deviceType.Name())
 	defer strings.CFree(cryptDeviceTypeName)
 
@@ -95,9 +220,10 @@ func (device *Device) Format(deviceType DeviceType, genericParams GenericParams)
 	}
 
 	var cVolumeKey *byte = nil
-	if len(genericParams.VolumeKey) > 0 {
-		cVolumeKey = strings.CString(genericParams.VolumeKey)
-		defer strings.CFree(cVolumeKey)
+	if len(volumeKey) > 0 {
+		var freeCVolumeKey func()
+		cVolumeKey, freeCVolumeKey = cSecret(volumeKey)
+		defer freeCVolumeKey()
 	}
 
 	cVolumeKeySize := uint64(genericParams.VolumeKeySize)
@@ -113,30 +239,75 @@ func (device *Device) Format(deviceType DeviceType, genericParams GenericParams)
 	return nil
 }
 
-// TODO: export progress_callback
+var (
+	progressFuncsMux = sync.Mutex{}
+	progressFuncs    = map[*crypt.CryptDevice]func(size, offset uint64) int{}
 
-var progressCallback func(size, offset uint64) int
+	// progressCallback is shared by all devices, as purego callbacks are limited and never released.
+	progressCallbackOnce sync.Once
+	progressCallback     uintptr
+)
+
+func progress_callback(size, offset uint64, usrptr unsafe.Pointer) int32 {
+	progressFuncsMux.Lock()
+	progress, ok := progressFuncs[(*crypt.CryptDevice)(usrptr)]
+	progressFuncsMux.Unlock()
 
-func progress_callback(size, offset uint64, usrptr unsafe.Pointer) int {
-	if progressCallback != nil {
-		return progressCallback(uint64(size), uint64(offset))
+	if ok {
+		return int32(progress(size, offset))
 	}
 	return 0
 }
 
+// setProgress sets the progress function of a crypt device for the duration of a call.
+// Returns the callback and usrptr to pass to libcryptsetup, and a function removing progress again.
+func setProgress(cd *crypt.CryptDevice, progress func(size, offset uint64) int) (uintptr, unsafe.Pointer, func()) {
+	if progress == nil {
+		return 0, nil, func() {}
+	}
+	progressCallbackOnce.Do(func() {
+		progressCallback = crypt.NewCallback(progress_callback)
+	})
+
+	progressFuncsMux.Lock()
+	defer progressFuncsMux.Unlock()
+
+	progressFuncs[cd] = progress
+	// The crypt_device pointer identifies the device, as Go pointers must not be kept by C code.
+	return progressCallback, unsafe.Pointer(cd), func() {
+		progressFuncsMux.Lock()
+		defer progressFuncsMux.Unlock()
+
+		delete(progressFuncs, cd)
+	}
+}
+
 // Wipe wipes/fills (part of) a device with the selected pattern.
+// If progress is not nil, it is called after each block; returning a non-zero value aborts the wipe.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_wipe
 func (device *Device) Wipe(devicePath string, pattern int, offset, length uint64, wipeBlockSize, flags int, progress func(size, offset uint64) int) error {
+	return device.WipeWithFlags(devicePath, pattern, offset, length, wipeBlockSize, WipeFlags(flags), progress)
+}
+
+// WipeWithFlags is like Wipe, but takes the flags as WipeFlags.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_wipe
+func (device *Device) WipeWithFlags(devicePath string, pattern int, offset, length uint64, wipeBlockSize int, flags WipeFlags, progress func(size, offset uint64) int) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	cWipeBlockSize := uint64(wipeBlockSize)
 
 	cDevicePath := strings.CString(devicePath)
 	defer strings.CFree(cDevicePath)
 
-	progressCallback = progress
+	cProgress, usrptr, unsetProgress := setProgress(device.cryptDevice, progress)
+	defer unsetProgress()
 
-	// TODO: handle progress callback
-	err := crypt.Wipe(device.cryptDevice, cDevicePath, 0, offset, length, cWipeBlockSize, uint32(flags), unsafe.Pointer(nil), nil)
+	err := crypt.Wipe(device.cryptDevice, cDevicePath, 0, offset, length, cWipeBlockSize, uint32(flags), cProgress, usrptr)
 	if err < 0 {
 		return &Error{functionName: "crypt_wipe", code: int(err)}
 	}
@@ -149,9 +320,21 @@ func (device *Device) Wipe(devicePath string, pattern int, offset, length uint64
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_resize
 func (device *Device) Resize(name string, newSize uint64) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	cryptDeviceName := strings.CString(name)
 	defer strings.CFree(cryptDeviceName)
 
+	// Pick up a grown backing file.
+	if device.loopDevice != nil {
+		if err := device.loopDevice.SetCapacity(); err != nil {
+			return err
+		}
+	}
+
 	err := crypt.Resize(device.cryptDevice, cryptDeviceName, uint64(newSize))
 	if err < 0 {
 		return &Error{functionName: "crypt_resize", code: int(err)}
@@ -165,6 +348,11 @@ func (device *Device) Resize(name string, newSize uint64) error {
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_load
 func (device *Device) Load(deviceType DeviceType) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	var cryptDeviceTypeName *byte
 	var cTypeParams unsafe.Pointer
 
@@ -186,35 +374,76 @@ func (device *Device) Load(deviceType DeviceType) error {
 }
 
 // KeyslotAddByVolumeKey adds a key slot using a volume key to perform the required security check.
+// Go strings are immutable, so only temporary copies of the secrets are wiped, not the strings themselves; use KeyslotAddByVolumeKeyBytes to wipe them.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_keyslot_add_by_volume_key
 func (device *Device) KeyslotAddByVolumeKey(keyslot int, volumeKey string, passphrase string) error {
+	volumeKeyBytes, passphraseBytes := []byte(volumeKey), []byte(passphrase)
+	defer WipeSecret(volumeKeyBytes)
+	defer WipeSecret(passphraseBytes)
+
+	_, err := device.KeyslotAddByVolumeKeyBytes(keyslot, volumeKeyBytes, passphraseBytes)
+	return err
+}
+
+// KeyslotAddByVolumeKeyBytes is like KeyslotAddByVolumeKey, but takes the secrets as byte slices.
+// The secrets are only copied to C memory for the duration of the call, and that copy is wiped.
+// The caller owns volumeKey and passphrase and should WipeSecret them when done.
+// Returns the allocated keyslot number on success, which is useful with CRYPT_ANY_SLOT, or an error otherwise.
+// C equivalent: crypt_keyslot_add_by_volume_key
+func (device *Device) KeyslotAddByVolumeKeyBytes(keyslot int, volumeKey []byte, passphrase []byte) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
 	var cVolumeKey *byte = nil
 	if len(volumeKey) > 0 {
-		cVolumeKey = strings.CString(volumeKey)
-		defer strings.CFree(cVolumeKey)
+		var freeCVolumeKey func()
+		cVolumeKey, freeCVolumeKey = cSecret(volumeKey)
+		defer freeCVolumeKey()
 	}
 
-	cPassphrase := strings.CString(passphrase)
-	defer strings.CFree(cPassphrase)
+	cPassphrase, freeCPassphrase := cSecret(passphrase)
+	defer freeCPassphrase()
 
 	err := crypt.KeyslotAddByVolumeKey(device.cryptDevice, uint32(keyslot), cVolumeKey, uint64(len(volumeKey)), cPassphrase, uint64(len(passphrase)))
 	if err < 0 {
-		return &Error{functionName: "crypt_keyslot_add_by_volume_key", code: int(err)}
+		return -1, &Error{functionName: "crypt_keyslot_add_by_volume_key", code: int(err)}
 	}
 
-	return nil
+	return int(err), nil
 }
 
 // KeyslotAddByPassphrase adds a key slot using a previously added passphrase to perform the required security check.
+// Go strings are immutable, so only temporary copies of the passphrases are wiped, not the strings themselves; use KeyslotAddByPassphraseBytes to wipe them.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_keyslot_add_by_passphrase
 func (device *Device) KeyslotAddByPassphrase(keyslot int, currentPassphrase string, newPassphrase string) error {
-	cCurrentPassphrase := strings.CString(currentPassphrase)
-	defer strings.CFree(cCurrentPassphrase)
+	currentPassphraseBytes, newPassphraseBytes := []byte(currentPassphrase), []byte(newPassphrase)
+	defer WipeSecret(currentPassphraseBytes)
+	defer WipeSecret(newPassphraseBytes)
+
+	_, err := device.KeyslotAddByPassphraseBytes(keyslot, currentPassphraseBytes, newPassphraseBytes)
+	return err
+}
+
+// KeyslotAddByPassphraseBytes is like KeyslotAddByPassphrase, but takes the passphrases as byte slices.
+// The passphrases are only copied to C memory for the duration of the call, and that copy is wiped.
+// The caller owns currentPassphrase and newPassphrase and should WipeSecret them when done.
+// Returns the allocated keyslot number on success, which is useful with CRYPT_ANY_SLOT, or an error otherwise.
+// C equivalent: crypt_keyslot_add_by_passphrase
+func (device *Device) KeyslotAddByPassphraseBytes(keyslot int, currentPassphrase []byte, newPassphrase []byte) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	cCurrentPassphrase, freeCCurrentPassphrase := cSecret(currentPassphrase)
+	defer freeCCurrentPassphrase()
 
-	cNewPassphrase := strings.CString(newPassphrase)
-	defer strings.CFree(cNewPassphrase)
+	cNewPassphrase, freeCNewPassphrase := cSecret(newPassphrase)
+	defer freeCNewPassphrase()
 
 	err := crypt.KeyslotAddByPassphrase(
 		device.cryptDevice, uint32(keyslot),
@@ -222,21 +451,42 @@ func (device *Device) KeyslotAddByPassphrase(keyslot int, currentPassphrase stri
 		cNewPassphrase, uint64(len(newPassphrase)),
 	)
 	if err < 0 {
-		return &Error{functionName: "crypt_keyslot_add_by_passphrase", code: int(err)}
+		return -1, &Error{functionName: "crypt_keyslot_add_by_passphrase", code: int(err)}
 	}
 
-	return nil
+	return int(err), nil
 }
 
 // KeyslotChangeByPassphrase changes a defined a key slot using a previously added passphrase to perform the required security check.
+// Go strings are immutable, so only temporary copies of the passphrases are wiped, not the strings themselves; use KeyslotChangeByPassphraseBytes to wipe them.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_keyslot_change_by_passphrase
 func (device *Device) KeyslotChangeByPassphrase(currentKeyslot int, newKeyslot int, currentPassphrase string, newPassphrase string) error {
-	cCurrentPassphrase := strings.CString(currentPassphrase)
-	defer strings.CFree(cCurrentPassphrase)
+	currentPassphraseBytes, newPassphraseBytes := []byte(currentPassphrase), []byte(newPassphrase)
+	defer WipeSecret(currentPassphraseBytes)
+	defer WipeSecret(newPassphraseBytes)
+
+	_, err := device.KeyslotChangeByPassphraseBytes(currentKeyslot, newKeyslot, currentPassphraseBytes, newPassphraseBytes)
+	return err
+}
+
+// KeyslotChangeByPassphraseBytes is like KeyslotChangeByPassphrase, but takes the passphrases as byte slices.
+// The passphrases are only copied to C memory for the duration of the call, and that copy is wiped.
+// The caller owns currentPassphrase and newPassphrase and should WipeSecret them when done.
+// Returns the keyslot number the new passphrase was stored in on success, which is useful with CRYPT_ANY_SLOT,
+// or an error otherwise.
+// C equivalent: crypt_keyslot_change_by_passphrase
+func (device *Device) KeyslotChangeByPassphraseBytes(currentKeyslot int, newKeyslot int, currentPassphrase []byte, newPassphrase []byte) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
 
-	cNewPassphrase := strings.CString(newPassphrase)
-	defer strings.CFree(cNewPassphrase)
+	cCurrentPassphrase, freeCCurrentPassphrase := cSecret(currentPassphrase)
+	defer freeCCurrentPassphrase()
+
+	cNewPassphrase, freeCNewPassphrase := cSecret(newPassphrase)
+	defer freeCNewPassphrase()
 
 	err := crypt.KeyslotChangeByPassphrase(
 		device.cryptDevice,
@@ -246,37 +496,81 @@ func (device *Device) KeyslotChangeByPassphrase(currentKeyslot int, newKeyslot i
 		cNewPassphrase, uint64(len(newPassphrase)),
 	)
 	if err < 0 {
-		return &Error{functionName: "crypt_keyslot_change_by_passphrase", code: int(err)}
+		return -1, &Error{functionName: "crypt_keyslot_change_by_passphrase", code: int(err)}
 	}
 
-	return nil
+	return int(err), nil
 }
 
 // ActivateByPassphrase activates a device by using a passphrase from a specific keyslot.
 // If deviceName is empty only check passphrase.
+// Go strings are immutable, so only a temporary copy of the passphrase is wiped, not the string itself; use ActivateByPassphraseBytes to wipe it.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_activate_by_passphrase
 func (device *Device) ActivateByPassphrase(deviceName string, keyslot int, passphrase string, flags int) error {
+	passphraseBytes := []byte(passphrase)
+	defer WipeSecret(passphraseBytes)
+
+	_, err := device.ActivateByPassphraseBytes(deviceName, keyslot, passphraseBytes, ActivateFlags(flags))
+	return err
+}
+
+// ActivateByPassphraseBytes is like ActivateByPassphrase, but takes the passphrase as a byte slice.
+// The passphrase is only copied to C memory for the duration of the call, and that copy is wiped.
+// The caller owns passphrase and should WipeSecret it when done.
+// Returns the unlocked keyslot number on success, which is useful with CRYPT_ANY_SLOT, or an error otherwise.
+// C equivalent: crypt_activate_by_passphrase
+func (device *Device) ActivateByPassphraseBytes(deviceName string, keyslot int, passphrase []byte, flags ActivateFlags) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	if err := device.validateActivateFlags(flags); err != nil {
+		return -1, err
+	}
+
 	var cryptDeviceName *byte = nil
 	if len(deviceName) > 0 {
 		cryptDeviceName = strings.CString(deviceName)
 		defer strings.CFree(cryptDeviceName)
 	}
 
-	cPassphrase := strings.CString(passphrase)
-	defer strings.CFree(cPassphrase)
+	cPassphrase, freeCPassphrase := cSecret(passphrase)
+	defer freeCPassphrase()
 
 	err := crypt.ActivateByPassphrase(device.cryptDevice, cryptDeviceName, uint32(keyslot), cPassphrase, uint64(len(passphrase)), uint32(flags))
 	if err < 0 {
-		return &Error{functionName: "crypt_activate_by_passphrase", code: int(err)}
+		return -1, &Error{functionName: "crypt_activate_by_passphrase", code: int(err)}
 	}
 
-	return nil
+	return int(err), nil
 }
 
 // ActivateByToken activates a device or checks key using a token.
 // C equivalent: crypt_activate_by_token
 func (device *Device) ActivateByToken(deviceName string, token int, usrptr string, flags int) error {
+	usrptrBytes := []byte(usrptr)
+	defer WipeSecret(usrptrBytes)
+
+	_, err := device.ActivateByTokenKeyslot(deviceName, token, usrptrBytes, ActivateFlags(flags))
+	return err
+}
+
+// ActivateByTokenKeyslot is like ActivateByToken, but also returns the keyslot unlocked by the token.
+// usrptr may hold binary data. It is passed to the token handler as a NUL-terminated copy, which is wiped afterwards.
+// Returns the keyslot number on success, or an error otherwise.
+// C equivalent: crypt_activate_by_token
+func (device *Device) ActivateByTokenKeyslot(deviceName string, token int, usrptr []byte, flags ActivateFlags) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	if err := device.validateActivateFlags(flags); err != nil {
+		return -1, err
+	}
+
 	var cryptDeviceName *byte = nil
 	if len(deviceName) > 0 {
 		cryptDeviceName = strings.CString(deviceName)
@@ -285,22 +579,89 @@ func (device *Device) ActivateByToken(deviceName string, token int, usrptr strin
 
 	var cUsrptr *byte = nil
 	if len(usrptr) > 0 {
-		cUsrptr = strings.CString(usrptr)
-		defer strings.CFree(cUsrptr)
+		var freeCUsrptr func()
+		cUsrptr, freeCUsrptr = cSecret(usrptr)
+		defer freeCUsrptr()
 	}
 
 	err := crypt.ActivateByToken(device.cryptDevice, cryptDeviceName, uint32(token), unsafe.Pointer(cUsrptr), uint32(flags))
 	if err < 0 {
-		return &Error{functionName: "crypt_activate_by_token", code: int(err)}
+		return -1, &Error{functionName: "crypt_activate_by_token", code: int(err)}
 	}
-	return nil
+	return int(err), nil
+}
+
+// ActivateByTokenPIN activates a device or checks key using a token that requires a PIN.
+// If tokenType is empty, tokens of any type are considered.
+// Returns the unlocked keyslot number on success, or an error otherwise.
+// C equivalent: crypt_activate_by_token_pin
+func (device *Device) ActivateByTokenPIN(deviceName string, tokenType string, token int, pin []byte, flags ActivateFlags) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	if err := device.validateActivateFlags(flags); err != nil {
+		return -1, err
+	}
+
+	if err := supported("crypt_activate_by_token_pin"); err != nil {
+		return -1, err
+	}
+
+	var cryptDeviceName *byte = nil
+	if len(deviceName) > 0 {
+		cryptDeviceName = strings.CString(deviceName)
+		defer strings.CFree(cryptDeviceName)
+	}
+
+	var cTokenType *byte = nil
+	if len(tokenType) > 0 {
+		cTokenType = strings.CString(tokenType)
+		defer strings.CFree(cTokenType)
+	}
+
+	var cPIN *byte = nil
+	if len(pin) > 0 {
+		var freeCPIN func()
+		cPIN, freeCPIN = cSecret(pin)
+		defer freeCPIN()
+	}
+
+	res := crypt.ActivateByTokenPIN(device.cryptDevice, cryptDeviceName, cTokenType, int32(token), cPIN, uint64(len(pin)), nil, uint32(flags))
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_activate_by_token_pin", code: int(res)}
+	}
+	return int(res), nil
 }
 
 // ActivateByVolumeKey activates a device by using a volume key.
 // If deviceName is empty only check passphrase.
+// Go strings are immutable, so only a temporary copy of the volume key is wiped, not the string itself; use ActivateByVolumeKeyBytes to wipe it.
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_activate_by_volume_key
 func (device *Device) ActivateByVolumeKey(deviceName string, volumeKey string, volumeKeySize int, flags int) error {
+	volumeKeyBytes := []byte(volumeKey)
+	defer WipeSecret(volumeKeyBytes)
+
+	return device.ActivateByVolumeKeyBytes(deviceName, volumeKeyBytes, volumeKeySize, ActivateFlags(flags))
+}
+
+// ActivateByVolumeKeyBytes is like ActivateByVolumeKey, but takes the volume key as a byte slice.
+// The volume key is only copied to C memory for the duration of the call, and that copy is wiped.
+// The caller owns volumeKey and should WipeSecret it when done.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_volume_key
+func (device *Device) ActivateByVolumeKeyBytes(deviceName string, volumeKey []byte, volumeKeySize int, flags ActivateFlags) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if err := device.validateActivateFlags(flags); err != nil {
+		return err
+	}
+
 	var cryptDeviceName *byte = nil
 	if len(deviceName) > 0 {
 		cryptDeviceName = strings.CString(deviceName)
@@ -309,8 +670,9 @@ func (device *Device) ActivateByVolumeKey(deviceName string, volumeKey string, v
 
 	var cVolumeKey *byte = nil
 	if len(volumeKey) > 0 {
-		cVolumeKey = strings.CString(volumeKey)
-		defer strings.CFree(cVolumeKey)
+		var freeCVolumeKey func()
+		cVolumeKey, freeCVolumeKey = cSecret(volumeKey)
+		defer freeCVolumeKey()
 	}
 
 	err := crypt.ActivateByVolumeKey(device.cryptDevice, cryptDeviceName, cVolumeKey, uint64(volumeKeySize), uint32(flags))
@@ -325,6 +687,11 @@ func (device *Device) ActivateByVolumeKey(deviceName string, volumeKey string, v
 // Returns nil on success, or an error otherwise.
 // C equivalent: crypt_deactivate
 func (device *Device) Deactivate(deviceName string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	cryptDeviceName := strings.CString(deviceName)
 	defer strings.CFree(cryptDeviceName)
 
@@ -337,26 +704,52 @@ func (device *Device) Deactivate(deviceName string) error {
 }
 
 // SetDebugLevel sets the debug level for the library.
+// Returns an error if the library cannot be loaded.
 // C equivalent: crypt_set_debug_level
-func SetDebugLevel(debugLevel int) {
-	mustInitialize()
+func SetDebugLevel(level int) error {
+	if err := ensureIntialized(); err != nil {
+		return err
+	}
 
-	crypt.SetDebugLevel(int32(debugLevel))
+	crypt.SetDebugLevel(int32(level))
+	debugLevel.Store(int32(level))
+	return nil
 }
 
+// debugLevel is the level last set with SetDebugLevel.
+var debugLevel atomic.Int32
+
 // VolumeKeyGet gets the volume key from a crypt device.
+// Go strings are immutable, so only a temporary copy of the passphrase is wiped, not the string itself; use VolumeKeyGetBytes to wipe it.
 // Returns a slice of bytes having the volume key and the unlocked key slot number, or an error otherwise.
 // C equivalent: crypt_volume_key_get
 func (device *Device) VolumeKeyGet(keyslot int, passphrase string) ([]byte, int, error) {
-	cPassphrase := strings.CString(passphrase)
-	defer strings.CFree(cPassphrase)
+	passphraseBytes := []byte(passphrase)
+	defer WipeSecret(passphraseBytes)
+
+	return device.VolumeKeyGetBytes(keyslot, passphraseBytes)
+}
+
+// VolumeKeyGetBytes is like VolumeKeyGet, but takes the passphrase as a byte slice.
+// The secrets are only held in C memory for the duration of the call, and that memory is wiped.
+// The caller owns passphrase and the returned volume key and should WipeSecret them when done.
+// Returns a slice of bytes having the volume key and the unlocked key slot number, or an error otherwise.
+// C equivalent: crypt_volume_key_get
+func (device *Device) VolumeKeyGetBytes(keyslot int, passphrase []byte) ([]byte, int, error) {
+	if err := device.lock(); err != nil {
+		return []byte{}, 0, err
+	}
+	defer device.mux.Unlock()
+
+	cPassphrase, freeCPassphrase := cSecret(passphrase)
+	defer freeCPassphrase()
 
 	cVKSize := crypt.GetVolumeKeySize(device.cryptDevice)
-	cVKSizePointer := libc.Malloc(uint64(cVKSize))
+	cVKSizePointer := strings.SecretAlloc(uint64(cVKSize))
 	if cVKSizePointer == nil {
-		return []byte{}, 0, &Error{functionName: "malloc"}
+		return []byte{}, 0, &Error{functionName: "crypt_safe_alloc"}
 	}
-	defer libc.Free(cVKSizePointer)
+	defer strings.SecretFree(cVKSizePointer)
 
 	err := crypt.VolumeKeyGet(
 		device.cryptDevice, int32(keyslot),
@@ -370,15 +763,37 @@ func (device *Device) VolumeKeyGet(keyslot int, passphrase string) ([]byte, int,
 }
 
 // GetDeviceName gets the path to the underlying device.
+// If Init attached a loop device, this is the path of the loop device, see BackingFile.
 // C equivalent: crypt_get_device_name
 func (device *Device) GetDeviceName() string {
+	if device.lock() != nil {
+		return ""
+	}
+	defer device.mux.Unlock()
+
 	res := crypt.GetDeviceName(device.cryptDevice)
 	return strings.GoString(res)
 }
 
+// BackingFile gets the path of the regular file Init attached to a loop device.
+// Returns an empty string if Init did not attach a loop device.
+func (device *Device) BackingFile() string {
+	if device.lock() != nil {
+		return ""
+	}
+	defer device.mux.Unlock()
+
+	return device.backingFile
+}
+
 // GetUUID gets the device's UUID.
 // C equivalent: crypt_get_uuid
 func (device *Device) GetUUID() string {
+	if device.lock() != nil {
+		return ""
+	}
+	defer device.mux.Unlock()
+
 	res := crypt.GetUUID(device.cryptDevice)
 	return strings.GoString(res)
 }
@@ -386,6 +801,16 @@ func (device *Device) GetUUID() string {
 // TokenJSONGet gets content of a token definition in JSON format.
 // C equivalent: crypt_token_json_get
 func (device *Device) TokenJSONGet(token int) (string, error) {
+	if err := device.lock(); err != nil {
+		return "", err
+	}
+	defer device.mux.Unlock()
+
+	return device.tokenJSONGet(token)
+}
+
+// tokenJSONGet is TokenJSONGet for callers holding the device lock.
+func (device *Device) tokenJSONGet(token int) (string, error) {
 	cStr := strings.CString("")
 	defer strings.CFree(cStr)
 
@@ -401,6 +826,11 @@ func (device *Device) TokenJSONGet(token int) (string, error) {
 // Returns allocated token ID on success, or an error otherwise.
 // C equivalent: crypt_token_json_set
 func (device *Device) TokenJSONSet(token int, json string) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
 	cStr := strings.CString(json)
 	defer strings.CFree(cStr)
 
@@ -414,6 +844,11 @@ func (device *Device) TokenJSONSet(token int, json string) (int, error) {
 // TokenLUKS2KeyRingGet gets LUKS2 keyring token params.
 // C equivalent: crypt_token_luks2_keyring_get
 func (device *Device) TokenLUKS2KeyRingGet(token int) (TokenParamsLUKS2Keyring, error) {
+	if err := device.lock(); err != nil {
+		return TokenParamsLUKS2Keyring{}, err
+	}
+	defer device.mux.Unlock()
+
 	cParams := (*crypt.TokenParamsLUKS2Keyring)(libc.Malloc(uint64(crypt.SizeofTokenParamsLUKS2Keyring)))
 	defer strings.Free(cParams)
 
@@ -430,6 +865,11 @@ func (device *Device) TokenLUKS2KeyRingGet(token int) (TokenParamsLUKS2Keyring,
 // TokenLUKS2KeyRingSet creates a new luks2 keyring token.
 // C equivalent: crypt_token_luks2_keyring_set
 func (device *Device) TokenLUKS2KeyRingSet(token int, params TokenParamsLUKS2Keyring) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
 	cKeyDescription := strings.CString(params.KeyDescription)
 	defer strings.CFree(cKeyDescription)
 	cParams := (*crypt.TokenParamsLUKS2Keyring)(libc.Malloc(uint64(crypt.SizeofTokenParamsLUKS2Keyring)))
@@ -448,6 +888,11 @@ func (device *Device) TokenLUKS2KeyRingSet(token int, params TokenParamsLUKS2Key
 // Use CRYPT_ANY SLOT to assign all active keyslots to token.
 // C equivalent: crypt_token_assign_keyslot
 func (device *Device) TokenAssignKeyslot(token int, keyslot int) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	res := crypt.TokenAssignKeyslot(device.cryptDevice, uint32(token), uint32(keyslot))
 
 	// libcryptsetup returns the token ID on success
@@ -466,6 +911,11 @@ func (device *Device) TokenAssignKeyslot(token int, keyslot int) error {
 // Use CRYPT_ANY SLOT to unassign all active keyslots from token.
 // C equivalent: crypt_token_unassign_keyslot
 func (device *Device) TokenUnassignKeyslot(token int, keyslot int) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	res := crypt.TokenUnassignKeyslot(device.cryptDevice, uint32(token), uint32(keyslot))
 	resAnyToken := token == CRYPT_ANY_TOKEN && int(res) == token
 	if res < 0 && !resAnyToken {
@@ -477,6 +927,11 @@ func (device *Device) TokenUnassignKeyslot(token int, keyslot int) error {
 // TokenIsAssigned gets info about token assignment to particular keyslot.
 // C equivalent: crypt_token_is_assigned
 func (device *Device) TokenIsAssigned(token int, keyslot int) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
 	if res := crypt.TokenIsAssigned(device.cryptDevice, uint32(token), uint32(keyslot)); res < 0 {
 		return &Error{functionName: "crypt_token_is_assigned", code: int(res)}
 	}
@@ -487,6 +942,16 @@ func (device *Device) TokenIsAssigned(token int, keyslot int) error {
 // On success returns the token type as string.
 // C equivalent: crypt_token_status
 func (device *Device) TokenStatus(token int) (string, TokenInfo) {
+	if device.lock() != nil {
+		return "", CRYPT_TOKEN_INVALID
+	}
+	defer device.mux.Unlock()
+
+	return device.tokenStatus(token)
+}
+
+// tokenStatus is TokenStatus for callers holding the device lock.
+func (device *Device) tokenStatus(token int) (string, TokenInfo) {
 	cStr := strings.CString("")
 	defer strings.CFree(cStr)
 
@@ -495,18 +960,60 @@ func (device *Device) TokenStatus(token int) (string, TokenInfo) {
 	return strings.GoString(cStr), tokenInfo
 }
 
-func ensureIntialized() error {
-	if err := crypt.OpenCryptsetup(); err != nil {
+// TokenMax returns the maximal number of tokens supported by the device type.
+// C equivalent: crypt_token_max
+func TokenMax(deviceType string) (int, error) {
+	if err := ensureIntialized(); err != nil {
+		return -1, err
+	}
+	if err := supported("crypt_token_max"); err != nil {
+		return -1, err
+	}
+
+	cDeviceType := strings.CString(deviceType)
+	defer strings.CFree(cDeviceType)
+
+	res := crypt.TokenMax(cDeviceType)
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_token_max", code: int(res)}
+	}
+	return int(res), nil
+}
+
+// TokenExternalDisable disables the loading of external token plugins.
+// It must be called before any token operation to take effect.
+// C equivalent: crypt_token_external_disable
+func TokenExternalDisable() error {
+	if err := ensureIntialized(); err != nil {
 		return err
 	}
-	if err := libc.OpenLibc(); err != nil {
+	if err := supported("crypt_token_external_disable"); err != nil {
 		return err
 	}
+
+	if res := crypt.TokenExternalDisable(); res < 0 {
+		return &Error{functionName: "crypt_token_external_disable", code: int(res)}
+	}
 	return nil
 }
 
-func mustInitialize() {
+// TokenExternalPath returns the directory where libcryptsetup looks for external token plugins.
+// Returns the directory, or an empty string if external tokens are disabled, on success,
+// or an error matching ErrNotSupported if libcryptsetup does not support external tokens.
+// C equivalent: crypt_token_external_path
+func TokenExternalPath() (string, error) {
 	if err := ensureIntialized(); err != nil {
-		panic(err)
+		return "", err
+	}
+	if err := supported("crypt_token_external_path"); err != nil {
+		return "", err
 	}
+
+	return strings.GoString(crypt.TokenExternalPath()), nil
+}
+
+// ensureIntialized loads the libraries with default options, unless Open was called before.
+func ensureIntialized() error {
+	_, err := Open(LibraryOptions{})
+	return err
 }
@@ -2,6 +2,11 @@ package cryptsetup
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -16,6 +21,34 @@ func Test_Device_Init_Works_If_Device_Is_Found(test *testing.T) {
 	}
 }
 
+func Test_Device_Init_Attaches_Loop_Device_For_Files(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+
+	if device.loopDevice == nil {
+		test.Fatal("Init should have attached a loop device.")
+	}
+	status, err := device.loopDevice.Status()
+	testWrapper.AssertNoError(err)
+	if !status.AutoClear {
+		test.Error("The loop device should be cleared automatically.")
+	}
+	loopPath := device.loopDevice.Path()
+	if device.GetDeviceName() != loopPath {
+		test.Errorf("Returned the wrong device path: got %s, expected %s", device.GetDeviceName(), loopPath)
+	}
+	if device.BackingFile() != DevicePath {
+		test.Errorf("Returned the wrong backing file: got %s, expected %s", device.BackingFile(), DevicePath)
+	}
+
+	device.Free()
+	if _, err := os.Stat("/sys/block/" + filepath.Base(loopPath) + "/loop/backing_file"); err == nil {
+		test.Errorf("%s should have been detached by Free.", loopPath)
+	}
+}
+
 func Test_Device_Init_Fails_If_Device_Is_Not_Found(test *testing.T) {
 	testWrapper := TestWrapper{test}
 
@@ -92,6 +125,69 @@ func Test_Device_Free_Doesnt_Fail_If_Called_Multiple_Times(test *testing.T) {
 	}
 }
 
+func Test_Device_Close(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	var closer io.Closer = device
+	testWrapper.AssertNoError(closer.Close())
+	if err := device.Close(); !errors.Is(err, ErrClosed) {
+		test.Errorf("Second Close should have returned ErrClosed, got %v", err)
+	}
+	if device.Free() {
+		test.Error("Free should have returned `false` after Close.")
+	}
+
+	if err := device.KeyslotAddByVolumeKey(0, "", PassKey); !errors.Is(err, ErrClosed) {
+		test.Errorf("KeyslotAddByVolumeKey should have returned ErrClosed, got %v", err)
+	}
+	if _, _, err := device.VolumeKeyGet(CRYPT_ANY_SLOT, PassKey); !errors.Is(err, ErrClosed) {
+		test.Errorf("VolumeKeyGet should have returned ErrClosed, got %v", err)
+	}
+	if _, err := device.Tokens(); !errors.Is(err, ErrClosed) {
+		test.Errorf("Tokens should have returned ErrClosed, got %v", err)
+	}
+	if device.Type() != "" || device.GetUUID() != "" {
+		test.Error("Type and GetUUID should be empty after Close.")
+	}
+}
+
+func Test_Device_Concurrent_Use(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				device.Type()
+				device.GetUUID()
+				device.TokenStatus(0)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		device.Free()
+	}()
+	wg.Wait()
+
+	if device.Free() {
+		test.Error("Device should have been freed.")
+	}
+}
+
 func Test_Device_Deactivate_Fails_If_Device_Is_Not_Active(test *testing.T) {
 	testWrapper := TestWrapper{test}
 
@@ -215,6 +311,43 @@ func Test_Device_VolumeKeyGet_Fails_If_Wrong_Passphrase(test *testing.T) {
 	}
 }
 
+func Test_Device_Keyslot_Indices(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte("firstPassphrase"))
+	testWrapper.AssertNoError(err)
+	if keyslot != 0 {
+		test.Errorf("Expected keyslot 0 to be allocated, got %d", keyslot)
+	}
+
+	keyslot, err = device.KeyslotAddByPassphraseBytes(CRYPT_ANY_SLOT, []byte("firstPassphrase"), []byte("secondPassphrase"))
+	testWrapper.AssertNoError(err)
+	if keyslot != 1 {
+		test.Errorf("Expected keyslot 1 to be allocated, got %d", keyslot)
+	}
+
+	keyslot, err = device.KeyslotChangeByPassphraseBytes(1, 5, []byte("secondPassphrase"), []byte("thirdPassphrase"))
+	testWrapper.AssertNoError(err)
+	if keyslot != 5 {
+		test.Errorf("Expected keyslot 5 to be used, got %d", keyslot)
+	}
+
+	keyslot, err = device.ActivateByPassphraseBytes("", CRYPT_ANY_SLOT, []byte("thirdPassphrase"), 0)
+	testWrapper.AssertNoError(err)
+	if keyslot != 5 {
+		test.Errorf("Expected keyslot 5 to be unlocked, got %d", keyslot)
+	}
+
+	_, err = device.ActivateByPassphraseBytes("", CRYPT_ANY_SLOT, []byte("wrongPassphrase"), 0)
+	testWrapper.AssertError(err)
+}
+
 func Test_Device_GetDeviceName(test *testing.T) {
 	testWrapper := TestWrapper{test}
 
@@ -224,9 +357,13 @@ func Test_Device_GetDeviceName(test *testing.T) {
 	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
 	testWrapper.AssertNoError(err)
 
+	expected := DevicePath
+	if device.loopDevice != nil {
+		expected = device.loopDevice.Path()
+	}
 	devicePath := device.GetDeviceName()
-	if devicePath != DevicePath {
-		test.Errorf("Returned the wrong device path: got %s, expected %s", devicePath, DevicePath)
+	if devicePath != expected {
+		test.Errorf("Returned the wrong device path: got %s, expected %s", devicePath, expected)
 	}
 }
 
@@ -363,3 +500,149 @@ func Test_Device_TokenAssignKeyslot(test *testing.T) {
 	err = device.TokenIsAssigned(tokenID, keyslot)
 	testWrapper.AssertError(err)
 }
+
+func Test_Device_ActivateByTokenPIN_Fails_If_No_Token(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "firstPassphrase")
+	testWrapper.AssertNoError(err)
+
+	keyslot, err := device.ActivateByTokenPIN("", "", CRYPT_ANY_TOKEN, []byte("1234"), 0)
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -2)
+	if keyslot != -1 {
+		test.Errorf("Expected keyslot to be -1, got %d", keyslot)
+	}
+}
+
+func Test_TokenMax(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	max, err := TokenMax(CRYPT_LUKS2)
+	testWrapper.AssertNoError(err)
+	if max != 32 {
+		test.Errorf("Expected 32 LUKS2 tokens, got %d", max)
+	}
+
+	_, err = TokenMax(CRYPT_LUKS1)
+	testWrapper.AssertError(err)
+}
+
+func Test_TokenExternalPath(test *testing.T) {
+	path, err := TokenExternalPath()
+	if errors.Is(err, ErrNotSupported) {
+		test.Skip("crypt_token_external_path is not supported by the loaded libcryptsetup")
+	}
+	if err != nil {
+		test.Fatal(err)
+	}
+	if path == "" {
+		test.Error("Expected the external token path, as external tokens are not disabled")
+	}
+}
+
+func Test_Device_Secret_Bytes(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	volumeKey := []byte(generateKey(512/8, test))
+	err = device.FormatBytes(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: len(volumeKey)}, volumeKey)
+	testWrapper.AssertNoError(err)
+
+	passphrase := []byte("binary\x00passphrase")
+	_, err = device.KeyslotAddByVolumeKeyBytes(0, volumeKey, passphrase)
+	testWrapper.AssertNoError(err)
+
+	_, err = device.ActivateByPassphraseBytes("", 0, passphrase, 0)
+	testWrapper.AssertNoError(err)
+
+	_, err = device.ActivateByPassphraseBytes("", 0, []byte("binary"), 0)
+	testWrapper.AssertError(err)
+
+	gotVolumeKey, keyslot, err := device.VolumeKeyGetBytes(CRYPT_ANY_SLOT, passphrase)
+	testWrapper.AssertNoError(err)
+	if keyslot != 0 {
+		test.Errorf("Expected keyslot 0, got %d", keyslot)
+	}
+	if string(gotVolumeKey) != string(volumeKey) {
+		test.Error("Returned volume key differs from the formatted one")
+	}
+
+	WipeSecret(gotVolumeKey)
+	for _, b := range gotVolumeKey {
+		if b != 0 {
+			test.Fatal("WipeSecret did not zero the volume key")
+		}
+	}
+}
+
+func Test_Device_Wipe_Progress_Per_Device(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	// Each device checks that it is only told about its own wipe length.
+	lengths := []uint64{2 << 20, 4 << 20}
+	calls := make([]int, len(lengths))
+	errs := make([]error, len(lengths))
+
+	var wg sync.WaitGroup
+	for i, length := range lengths {
+		device, err := Init(DevicePath)
+		testWrapper.AssertNoError(err)
+		defer device.Free()
+
+		i, length := i, length
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = device.Wipe(device.GetDeviceName(), CRYPT_WIPE_ZERO, 0, length, 1<<20, CRYPT_WIPE_NO_DIRECT_IO, func(size, offset uint64) int {
+				if size != length {
+					test.Errorf("Device %d got progress of a wipe of %d bytes, expected %d", i, size, length)
+				}
+				calls[i]++
+				return 0
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i := range lengths {
+		testWrapper.AssertNoError(errs[i])
+		if calls[i] == 0 {
+			test.Errorf("Progress of device %d was not reported", i)
+		}
+	}
+}
+
+func Test_Device_Wipe_Progress_Aborts(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Wipe(device.GetDeviceName(), CRYPT_WIPE_ZERO, 0, 4<<20, 1<<20, CRYPT_WIPE_NO_DIRECT_IO, func(size, offset uint64) int {
+		return 1
+	})
+	testWrapper.AssertError(err)
+}
+
+func Test_Device_WipeWithFlags(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.WipeWithFlags(device.GetDeviceName(), CRYPT_WIPE_ZERO, 0, 1<<20, 1<<20, WipeNoDirectIO, nil)
+	testWrapper.AssertNoError(err)
+}
@@ -1,6 +1,11 @@
 package cryptsetup
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+)
 
 // Error holds the name and the return value of a libcryptsetup function that was executed with an error.
 type Error struct {
@@ -16,3 +21,37 @@ func (e *Error) Error() string {
 func (e *Error) Code() int {
 	return e.code
 }
+
+// ErrClosed is returned by methods of a Device that has been freed.
+var ErrClosed = errors.New("device has been freed")
+
+// ErrNotSupported is matched by errors returned from functions that the loaded libcryptsetup does not provide.
+// Use errors.Is(err, ErrNotSupported) to check for it.
+var ErrNotSupported = errors.New("not supported by the loaded libcryptsetup")
+
+// NotSupportedError holds the name of a libcryptsetup function that is not provided by the loaded library.
+type NotSupportedError struct {
+	functionName string
+}
+
+func (e *NotSupportedError) Error() string {
+	return fmt.Sprintf("libcryptsetup function '%s' is not supported by the loaded library.", e.functionName)
+}
+
+// Is reports whether target is ErrNotSupported.
+func (e *NotSupportedError) Is(target error) bool {
+	return target == ErrNotSupported
+}
+
+// FunctionName returns the name of the unsupported libcryptsetup function.
+func (e *NotSupportedError) FunctionName() string {
+	return e.functionName
+}
+
+// supported returns a *NotSupportedError if the loaded libcryptsetup does not provide the function.
+func supported(functionName string) error {
+	if !crypt.Available(functionName) {
+		return &NotSupportedError{functionName: functionName}
+	}
+	return nil
+}
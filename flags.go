@@ -0,0 +1,290 @@
+package cryptsetup
+
+import (
+	"errors"
+	"fmt"
+	gostrings "strings"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// ErrInvalidFlags is matched by errors returned for flags that are not meaningful for the device type.
+var ErrInvalidFlags = errors.New("invalid flags")
+
+// ActivateFlags is a bitset of CRYPT_ACTIVATE_* flags.
+// The untyped CRYPT_ACTIVATE_* constants can be used wherever ActivateFlags or int flags are expected.
+type ActivateFlags uint32
+
+// Typed CRYPT_ACTIVATE_* flags.
+const (
+	ActivateReadOnly                 ActivateFlags = CRYPT_ACTIVATE_READONLY
+	ActivateNoUUID                   ActivateFlags = CRYPT_ACTIVATE_NO_UUID
+	ActivateShared                   ActivateFlags = CRYPT_ACTIVATE_SHARED
+	ActivateAllowDiscards            ActivateFlags = CRYPT_ACTIVATE_ALLOW_DISCARDS
+	ActivatePrivate                  ActivateFlags = CRYPT_ACTIVATE_PRIVATE
+	ActivateCorrupted                ActivateFlags = CRYPT_ACTIVATE_CORRUPTED
+	ActivateSameCPUCrypt             ActivateFlags = CRYPT_ACTIVATE_SAME_CPU_CRYPT
+	ActivateSubmitFromCryptCPUs      ActivateFlags = CRYPT_ACTIVATE_SUBMIT_FROM_CRYPT_CPUS
+	ActivateIgnoreCorruption         ActivateFlags = CRYPT_ACTIVATE_IGNORE_CORRUPTION
+	ActivateRestartOnCorruption      ActivateFlags = CRYPT_ACTIVATE_RESTART_ON_CORRUPTION
+	ActivateIgnoreZeroBlocks         ActivateFlags = CRYPT_ACTIVATE_IGNORE_ZERO_BLOCKS
+	ActivateKeyringKey               ActivateFlags = CRYPT_ACTIVATE_KEYRING_KEY
+	ActivateNoJournal                ActivateFlags = CRYPT_ACTIVATE_NO_JOURNAL
+	ActivateRecovery                 ActivateFlags = CRYPT_ACTIVATE_RECOVERY
+	ActivateIgnorePersistent         ActivateFlags = CRYPT_ACTIVATE_IGNORE_PERSISTENT
+	ActivateCheckAtMostOnce          ActivateFlags = CRYPT_ACTIVATE_CHECK_AT_MOST_ONCE
+	ActivateAllowUnboundKey          ActivateFlags = CRYPT_ACTIVATE_ALLOW_UNBOUND_KEY
+	ActivateRecalculate              ActivateFlags = CRYPT_ACTIVATE_RECALCULATE
+	ActivateRefresh                  ActivateFlags = CRYPT_ACTIVATE_REFRESH
+	ActivateSerializeMemoryHardPBKDF ActivateFlags = CRYPT_ACTIVATE_SERIALIZE_MEMORY_HARD_PBKDF
+	ActivateNoJournalBitmap          ActivateFlags = CRYPT_ACTIVATE_NO_JOURNAL_BITMAP
+	ActivateSuspended                ActivateFlags = CRYPT_ACTIVATE_SUSPENDED
+	ActivateIVLargeSectors           ActivateFlags = CRYPT_ACTIVATE_IV_LARGE_SECTORS
+	ActivatePanicOnCorruption        ActivateFlags = CRYPT_ACTIVATE_PANIC_ON_CORRUPTION
+	ActivateNoReadWorkqueue          ActivateFlags = CRYPT_ACTIVATE_NO_READ_WORKQUEUE
+	ActivateNoWriteWorkqueue         ActivateFlags = CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE
+	ActivateRecalculateReset         ActivateFlags = CRYPT_ACTIVATE_RECALCULATE_RESET
+	ActivateHighPriority             ActivateFlags = CRYPT_ACTIVATE_HIGH_PRIORITY
+)
+
+var activateFlagNames = []flagName{
+	{CRYPT_ACTIVATE_READONLY, "READONLY"},
+	{CRYPT_ACTIVATE_NO_UUID, "NO_UUID"},
+	{CRYPT_ACTIVATE_SHARED, "SHARED"},
+	{CRYPT_ACTIVATE_ALLOW_DISCARDS, "ALLOW_DISCARDS"},
+	{CRYPT_ACTIVATE_PRIVATE, "PRIVATE"},
+	{CRYPT_ACTIVATE_CORRUPTED, "CORRUPTED"},
+	{CRYPT_ACTIVATE_SAME_CPU_CRYPT, "SAME_CPU_CRYPT"},
+	{CRYPT_ACTIVATE_SUBMIT_FROM_CRYPT_CPUS, "SUBMIT_FROM_CRYPT_CPUS"},
+	{CRYPT_ACTIVATE_IGNORE_CORRUPTION, "IGNORE_CORRUPTION"},
+	{CRYPT_ACTIVATE_RESTART_ON_CORRUPTION, "RESTART_ON_CORRUPTION"},
+	{CRYPT_ACTIVATE_IGNORE_ZERO_BLOCKS, "IGNORE_ZERO_BLOCKS"},
+	{CRYPT_ACTIVATE_KEYRING_KEY, "KEYRING_KEY"},
+	{CRYPT_ACTIVATE_NO_JOURNAL, "NO_JOURNAL"},
+	{CRYPT_ACTIVATE_RECOVERY, "RECOVERY"},
+	{CRYPT_ACTIVATE_IGNORE_PERSISTENT, "IGNORE_PERSISTENT"},
+	{CRYPT_ACTIVATE_CHECK_AT_MOST_ONCE, "CHECK_AT_MOST_ONCE"},
+	{CRYPT_ACTIVATE_ALLOW_UNBOUND_KEY, "ALLOW_UNBOUND_KEY"},
+	{CRYPT_ACTIVATE_RECALCULATE, "RECALCULATE"},
+	{CRYPT_ACTIVATE_REFRESH, "REFRESH"},
+	{CRYPT_ACTIVATE_SERIALIZE_MEMORY_HARD_PBKDF, "SERIALIZE_MEMORY_HARD_PBKDF"},
+	{CRYPT_ACTIVATE_NO_JOURNAL_BITMAP, "NO_JOURNAL_BITMAP"},
+	{CRYPT_ACTIVATE_SUSPENDED, "SUSPENDED"},
+	{CRYPT_ACTIVATE_IV_LARGE_SECTORS, "IV_LARGE_SECTORS"},
+	{CRYPT_ACTIVATE_PANIC_ON_CORRUPTION, "PANIC_ON_CORRUPTION"},
+	{CRYPT_ACTIVATE_NO_READ_WORKQUEUE, "NO_READ_WORKQUEUE"},
+	{CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE, "NO_WRITE_WORKQUEUE"},
+	{CRYPT_ACTIVATE_RECALCULATE_RESET, "RECALCULATE_RESET"},
+	{CRYPT_ACTIVATE_HIGH_PRIORITY, "HIGH_PRIORITY"},
+}
+
+// Activation flags grouped by the device-mapper target they apply to.
+const (
+	activateCommonFlags ActivateFlags = ActivateReadOnly | ActivateNoUUID | ActivateShared | ActivatePrivate |
+		ActivateIgnorePersistent | ActivateRefresh | ActivateSuspended
+	activateCryptFlags ActivateFlags = ActivateAllowDiscards | ActivateSameCPUCrypt | ActivateSubmitFromCryptCPUs |
+		ActivateKeyringKey | ActivateIVLargeSectors | ActivateNoReadWorkqueue | ActivateNoWriteWorkqueue | ActivateHighPriority
+	activateVerityFlags ActivateFlags = ActivateIgnoreCorruption | ActivateRestartOnCorruption | ActivateIgnoreZeroBlocks |
+		ActivateCheckAtMostOnce | ActivatePanicOnCorruption
+	activateIntegrityFlags ActivateFlags = ActivateAllowDiscards | ActivateNoJournal | ActivateRecovery | ActivateRecalculate |
+		ActivateNoJournalBitmap | ActivateRecalculateReset
+	activateLUKS2Flags ActivateFlags = ActivateAllowUnboundKey | ActivateSerializeMemoryHardPBKDF
+	// activateOutputFlags are only reported for active devices and cannot be requested.
+	activateOutputFlags ActivateFlags = ActivateCorrupted
+)
+
+// Has reports whether all flags in flag are set.
+func (flags ActivateFlags) Has(flag ActivateFlags) bool {
+	return flags&flag == flag
+}
+
+// String returns the flags as CRYPT_ACTIVATE_* names without prefix, separated by |, e.g. READONLY|ALLOW_DISCARDS.
+func (flags ActivateFlags) String() string {
+	return formatFlags(uint32(flags), activateFlagNames)
+}
+
+// Validate checks that the flags are meaningful for devices of deviceType, e.g. CRYPT_LUKS2.
+// Flags only reported for active devices, such as CRYPT_ACTIVATE_CORRUPTED, are always rejected.
+// Otherwise, flags unknown to this package and device types without known flags are not checked.
+// Returns nil if the flags are valid, or an error matching ErrInvalidFlags otherwise.
+func (flags ActivateFlags) Validate(deviceType string) error {
+	if output := flags & activateOutputFlags; output != 0 {
+		return fmt.Errorf("activation flags %s are only reported for active devices: %w", output, ErrInvalidFlags)
+	}
+
+	var valid ActivateFlags
+	switch deviceType {
+	case CRYPT_LUKS2:
+		valid = activateCryptFlags | activateIntegrityFlags | activateLUKS2Flags
+	case CRYPT_LUKS1, CRYPT_PLAIN, CRYPT_LOOPAES, CRYPT_TCRYPT, CRYPT_BITLK, CRYPT_FVAULT2:
+		valid = activateCryptFlags
+	case CRYPT_VERITY:
+		valid = activateVerityFlags
+	case CRYPT_INTEGRITY:
+		valid = activateIntegrityFlags
+	default:
+		return nil
+	}
+
+	known := activateCommonFlags | activateCryptFlags | activateVerityFlags | activateIntegrityFlags | activateLUKS2Flags
+	if invalid := flags & known &^ (activateCommonFlags | valid); invalid != 0 {
+		return fmt.Errorf("activation flags %s are not supported by %s devices: %w", invalid, deviceType, ErrInvalidFlags)
+	}
+	return nil
+}
+
+// validateActivateFlags validates flags for the type of the loaded device.
+func (device *Device) validateActivateFlags(flags ActivateFlags) error {
+	return flags.Validate(strings.GoString(crypt.GetType(device.cryptDevice)))
+}
+
+// DeactivateFlags is a bitset of CRYPT_DEACTIVATE_* flags.
+type DeactivateFlags uint32
+
+// Typed CRYPT_DEACTIVATE_* flags.
+const (
+	DeactivateDeferred       DeactivateFlags = CRYPT_DEACTIVATE_DEFERRED
+	DeactivateForce          DeactivateFlags = CRYPT_DEACTIVATE_FORCE
+	DeactivateDeferredCancel DeactivateFlags = CRYPT_DEACTIVATE_DEFERRED_CANCEL
+)
+
+var deactivateFlagNames = []flagName{
+	{CRYPT_DEACTIVATE_DEFERRED, "DEFERRED"},
+	{CRYPT_DEACTIVATE_FORCE, "FORCE"},
+	{CRYPT_DEACTIVATE_DEFERRED_CANCEL, "DEFERRED_CANCEL"},
+}
+
+// Has reports whether all flags in flag are set.
+func (flags DeactivateFlags) Has(flag DeactivateFlags) bool {
+	return flags&flag == flag
+}
+
+// String returns the flags as CRYPT_DEACTIVATE_* names without prefix, separated by |.
+func (flags DeactivateFlags) String() string {
+	return formatFlags(uint32(flags), deactivateFlagNames)
+}
+
+// WipeFlags is a bitset of CRYPT_WIPE_* flags, which are distinct from the CRYPT_WIPE_* patterns.
+type WipeFlags uint32
+
+// Typed CRYPT_WIPE_* flags.
+const (
+	WipeNoDirectIO WipeFlags = CRYPT_WIPE_NO_DIRECT_IO
+)
+
+var wipeFlagNames = []flagName{
+	{CRYPT_WIPE_NO_DIRECT_IO, "NO_DIRECT_IO"},
+}
+
+// Has reports whether all flags in flag are set.
+func (flags WipeFlags) Has(flag WipeFlags) bool {
+	return flags&flag == flag
+}
+
+// String returns the flags as CRYPT_WIPE_* names without prefix, separated by |.
+func (flags WipeFlags) String() string {
+	return formatFlags(uint32(flags), wipeFlagNames)
+}
+
+// flagName is the name of a flag for String methods.
+type flagName struct {
+	flag uint32
+	name string
+}
+
+// formatFlags joins the names of the set flags with |, followed by the remaining unknown bits in hexadecimal.
+func formatFlags(flags uint32, names []flagName) string {
+	if flags == 0 {
+		return "0"
+	}
+	var parts []string
+	for _, name := range names {
+		if flags&name.flag != 0 {
+			parts = append(parts, name.name)
+			flags &^= name.flag
+		}
+	}
+	if flags != 0 {
+		parts = append(parts, fmt.Sprintf("%#x", flags))
+	}
+	return gostrings.Join(parts, "|")
+}
+
+// RequirementFlags is a bitset of CRYPT_REQUIREMENT_* flags of a LUKS2 header.
+// Devices with requirements can only be handled by libcryptsetup versions supporting them.
+type RequirementFlags uint32
+
+// knownRequirements are the requirements defined by this package.
+const knownRequirements RequirementFlags = CRYPT_REQUIREMENT_OFFLINE_REENCRYPT | CRYPT_REQUIREMENT_ONLINE_REENCRYPT
+
+// Has reports whether all flags in flag are set.
+func (flags RequirementFlags) Has(flag RequirementFlags) bool {
+	return flags&flag == flag
+}
+
+// Unknown returns the requirements not defined by this package,
+// including CRYPT_REQUIREMENT_UNKNOWN reported by libcryptsetup for requirements unknown to it.
+func (flags RequirementFlags) Unknown() RequirementFlags {
+	return flags &^ knownRequirements
+}
+
+// SetPersistentFlags stores activation flags in the LUKS2 header, which are then applied on every activation.
+// Only CRYPT_ACTIVATE_ALLOW_DISCARDS, CRYPT_ACTIVATE_SAME_CPU_CRYPT, CRYPT_ACTIVATE_SUBMIT_FROM_CRYPT_CPUS,
+// CRYPT_ACTIVATE_NO_JOURNAL, CRYPT_ACTIVATE_NO_READ_WORKQUEUE, CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE and,
+// with libcryptsetup 2.7, CRYPT_ACTIVATE_HIGH_PRIORITY are persistent.
+// Use CRYPT_ACTIVATE_IGNORE_PERSISTENT to ignore them on activation.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_set
+func (device *Device) SetPersistentFlags(flags ActivateFlags) error {
+	return device.persistentFlagsSet(CRYPT_FLAGS_ACTIVATION, uint32(flags))
+}
+
+// GetPersistentFlags gets the activation flags stored in the LUKS2 header.
+// Returns the flags on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_get
+func (device *Device) GetPersistentFlags() (ActivateFlags, error) {
+	flags, err := device.persistentFlagsGet(CRYPT_FLAGS_ACTIVATION)
+	return ActivateFlags(flags), err
+}
+
+// SetRequirementFlags stores requirement flags in the LUKS2 header.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_set
+func (device *Device) SetRequirementFlags(flags RequirementFlags) error {
+	return device.persistentFlagsSet(CRYPT_FLAGS_REQUIREMENTS, uint32(flags))
+}
+
+// GetRequirementFlags gets the requirement flags of the LUKS2 header.
+// Use RequirementFlags.Unknown to detect headers that cannot be handled safely.
+// Returns the flags on success, or an error otherwise.
+// C equivalent: crypt_persistent_flags_get
+func (device *Device) GetRequirementFlags() (RequirementFlags, error) {
+	flags, err := device.persistentFlagsGet(CRYPT_FLAGS_REQUIREMENTS)
+	return RequirementFlags(flags), err
+}
+
+func (device *Device) persistentFlagsSet(flagsType uint32, flags uint32) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if res := crypt.PersistentFlagsSet(device.cryptDevice, flagsType, flags); res < 0 {
+		return &Error{functionName: "crypt_persistent_flags_set", code: int(res)}
+	}
+	return nil
+}
+
+func (device *Device) persistentFlagsGet(flagsType uint32) (uint32, error) {
+	if err := device.lock(); err != nil {
+		return 0, err
+	}
+	defer device.mux.Unlock()
+
+	var flags uint32
+	if res := crypt.PersistentFlagsGet(device.cryptDevice, flagsType, &flags); res < 0 {
+		return 0, &Error{functionName: "crypt_persistent_flags_get", code: int(res)}
+	}
+	return flags, nil
+}
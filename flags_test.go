@@ -0,0 +1,150 @@
+package cryptsetup
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func Test_RequirementFlags_Unknown(test *testing.T) {
+	flags := RequirementFlags(CRYPT_REQUIREMENT_OFFLINE_REENCRYPT)
+	if flags.Unknown() != 0 {
+		test.Errorf("Expected no unknown requirements, got %#x", flags.Unknown())
+	}
+
+	flags |= CRYPT_REQUIREMENT_UNKNOWN | 0x100
+	if flags.Unknown() != CRYPT_REQUIREMENT_UNKNOWN|0x100 {
+		test.Errorf("Unexpected unknown requirements %#x", flags.Unknown())
+	}
+	if !flags.Has(CRYPT_REQUIREMENT_OFFLINE_REENCRYPT | CRYPT_REQUIREMENT_UNKNOWN) {
+		test.Error("Flags should have offline reencryption and unknown requirements.")
+	}
+}
+
+func Test_Device_PersistentFlags(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	flags, err := device.GetPersistentFlags()
+	testWrapper.AssertNoError(err)
+	if flags != 0 {
+		test.Errorf("Expected no persistent flags, got %#x", flags)
+	}
+
+	testWrapper.AssertNoError(device.SetPersistentFlags(CRYPT_ACTIVATE_ALLOW_DISCARDS | CRYPT_ACTIVATE_NO_READ_WORKQUEUE))
+
+	reloaded, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer reloaded.Free()
+	testWrapper.AssertNoError(reloaded.Load(nil))
+
+	flags, err = reloaded.GetPersistentFlags()
+	testWrapper.AssertNoError(err)
+	if !flags.Has(CRYPT_ACTIVATE_ALLOW_DISCARDS|CRYPT_ACTIVATE_NO_READ_WORKQUEUE) || flags.Has(CRYPT_ACTIVATE_SAME_CPU_CRYPT) {
+		test.Errorf("Unexpected persistent flags %#x", flags)
+	}
+
+	requirements, err := reloaded.GetRequirementFlags()
+	testWrapper.AssertNoError(err)
+	if requirements != 0 {
+		test.Errorf("Expected no requirements, got %#x", requirements)
+	}
+}
+
+func Test_Device_PersistentFlags_Fails_For_LUKS1(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	testWrapper.AssertError(device.SetPersistentFlags(CRYPT_ACTIVATE_ALLOW_DISCARDS))
+}
+
+func Test_Flags_String(test *testing.T) {
+	for _, tc := range []struct {
+		flags    fmt.Stringer
+		expected string
+	}{
+		{ActivateFlags(0), "0"},
+		{ActivateReadOnly | ActivateAllowDiscards, "READONLY|ALLOW_DISCARDS"},
+		{ActivateNoReadWorkqueue | ActivateFlags(0x80000000), "NO_READ_WORKQUEUE|0x80000000"},
+		{DeactivateDeferred | DeactivateForce, "DEFERRED|FORCE"},
+		{DeactivateFlags(CRYPT_DEACTIVATE_DEFERRED_CANCEL), "DEFERRED_CANCEL"},
+		{WipeNoDirectIO, "NO_DIRECT_IO"},
+		{WipeFlags(0x10), "0x10"},
+	} {
+		if actual := tc.flags.String(); actual != tc.expected {
+			test.Errorf("Expected %q, got %q", tc.expected, actual)
+		}
+	}
+}
+
+func Test_ActivateFlags_Validate(test *testing.T) {
+	for _, tc := range []struct {
+		flags      ActivateFlags
+		deviceType string
+		valid      bool
+	}{
+		{ActivateReadOnly | ActivatePrivate, CRYPT_VERITY, true},
+		{ActivateAllowDiscards | ActivateNoReadWorkqueue, CRYPT_LUKS2, true},
+		{ActivateNoJournal | ActivateRecalculate, CRYPT_LUKS2, true},
+		{ActivateIgnoreZeroBlocks, CRYPT_LUKS2, false},
+		{ActivateNoJournal, CRYPT_LUKS1, false},
+		{ActivateAllowUnboundKey, CRYPT_PLAIN, false},
+		{ActivateIgnoreZeroBlocks | ActivateCheckAtMostOnce, CRYPT_VERITY, true},
+		{ActivateSameCPUCrypt, CRYPT_VERITY, false},
+		{ActivateNoJournal | ActivateAllowDiscards, CRYPT_INTEGRITY, true},
+		{ActivateKeyringKey, CRYPT_INTEGRITY, false},
+		{ActivateIgnoreZeroBlocks, "", true},
+		{ActivateFlags(0x80000000), CRYPT_LUKS2, true},
+		{ActivateCorrupted, CRYPT_VERITY, false},
+		{ActivateCorrupted, "", false},
+	} {
+		err := tc.flags.Validate(tc.deviceType)
+		if tc.valid && err != nil {
+			test.Errorf("Expected %s to be valid for %q, got %v", tc.flags, tc.deviceType, err)
+		}
+		if !tc.valid && !errors.Is(err, ErrInvalidFlags) {
+			test.Errorf("Expected %s to be invalid for %q, got %v", tc.flags, tc.deviceType, err)
+		}
+	}
+}
+
+func Test_Device_Activate_Rejects_Invalid_Flags(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	_, err = device.KeyslotAddByVolumeKeyBytes(0, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	_, err = device.ActivateByPassphraseBytes("", 0, []byte(PassKey), CRYPT_ACTIVATE_IGNORE_ZERO_BLOCKS)
+	if !errors.Is(err, ErrInvalidFlags) {
+		test.Errorf("Expected invalid flags, got %v", err)
+	}
+	err = device.ActivateByVolumeKeyBytes("", nil, 512/8, CRYPT_ACTIVATE_RESTART_ON_CORRUPTION)
+	if !errors.Is(err, ErrInvalidFlags) {
+		test.Errorf("Expected invalid flags, got %v", err)
+	}
+
+	_, err = device.ActivateByPassphraseBytes("", 0, []byte(PassKey), CRYPT_ACTIVATE_READONLY|CRYPT_ACTIVATE_ALLOW_DISCARDS)
+	testWrapper.AssertNoError(err)
+	_, err = device.ActivateByPassphraseBytes("", 0, []byte(PassKey), ActivateReadOnly|ActivateAllowDiscards)
+	testWrapper.AssertNoError(err)
+	err = device.ActivateByPassphrase("", 0, PassKey, CRYPT_ACTIVATE_CORRUPTED)
+	if !errors.Is(err, ErrInvalidFlags) {
+		test.Errorf("Expected invalid flags, got %v", err)
+	}
+}
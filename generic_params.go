@@ -1,5 +1,7 @@
 package cryptsetup
 
+import "io"
+
 // GenericParams are device type independent parameters that are used to manipulate devices in various ways.
 type GenericParams struct {
 	Cipher        string
@@ -7,4 +9,8 @@ type GenericParams struct {
 	UUID          string
 	VolumeKey     string
 	VolumeKeySize int
+	// VolumeKeyReader is read for a volume key of VolumeKeySize bytes by Format if no volume key is given,
+	// e.g. crypto/rand.Reader or a reader backed by an HSM. The size is validated against well-known ciphers.
+	// If nil, libcryptsetup generates the volume key with its RNG, see SetRNGType.
+	VolumeKeyReader io.Reader
 }
@@ -2,6 +2,4 @@ module github.com/malt3/purego-cryptsetup
 
 go 1.20
 
-require github.com/ebitengine/purego v0.5.0-alpha.1
-
-require golang.org/x/sys v0.7.0 // indirect
+require github.com/ebitengine/purego v0.8.4
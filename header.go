@@ -0,0 +1,58 @@
+package cryptsetup
+
+import (
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// HeaderBackup writes a binary backup of the device's header to backupFile, which must not exist.
+// An empty deviceType backs up the header of any LUKS type.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_header_backup
+func (device *Device) HeaderBackup(deviceType string, backupFile string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	return device.headerBackup(deviceType, backupFile)
+}
+
+func (device *Device) headerBackup(deviceType string, backupFile string) error {
+	var cDeviceType *byte
+	if deviceType != "" {
+		cDeviceType = strings.CString(deviceType)
+		defer strings.CFree(cDeviceType)
+	}
+	cBackupFile := strings.CString(backupFile)
+	defer strings.CFree(cBackupFile)
+
+	if res := crypt.HeaderBackup(device.cryptDevice, cDeviceType, cBackupFile); res < 0 {
+		return &Error{functionName: "crypt_header_backup", code: int(res)}
+	}
+	return nil
+}
+
+// HeaderRestore restores the device's header from a backup created by HeaderBackup.
+// An empty deviceType restores a header of any LUKS type.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_header_restore
+func (device *Device) HeaderRestore(deviceType string, backupFile string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	var cDeviceType *byte
+	if deviceType != "" {
+		cDeviceType = strings.CString(deviceType)
+		defer strings.CFree(cDeviceType)
+	}
+	cBackupFile := strings.CString(backupFile)
+	defer strings.CFree(cBackupFile)
+
+	if res := crypt.HeaderRestore(device.cryptDevice, cDeviceType, cBackupFile); res < 0 {
+		return &Error{functionName: "crypt_header_restore", code: int(res)}
+	}
+	return nil
+}
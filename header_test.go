@@ -0,0 +1,28 @@
+package cryptsetup
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func Test_Device_HeaderBackup_Restore(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	uuid := device.GetUUID()
+
+	backupFile := filepath.Join(test.TempDir(), "header")
+	testWrapper.AssertNoError(device.HeaderBackup(CRYPT_LUKS2, backupFile))
+	testWrapper.AssertError(device.HeaderBackup(CRYPT_LUKS2, backupFile))
+
+	testWrapper.AssertNoError(device.SetUUID(""))
+	testWrapper.AssertError(device.HeaderRestore(CRYPT_LUKS1, backupFile))
+	testWrapper.AssertNoError(device.HeaderRestore(CRYPT_LUKS2, backupFile))
+	if device.GetUUID() != uuid {
+		test.Errorf("Expected restored UUID %s, got %s", uuid, device.GetUUID())
+	}
+}
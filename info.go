@@ -0,0 +1,164 @@
+package cryptsetup
+
+import (
+	"fmt"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// DeviceInfo describes the header of a formatted or loaded device.
+type DeviceInfo struct {
+	Type       string
+	UUID       string
+	Cipher     string
+	CipherMode string
+
+	// VolumeKeySize is 0 for LUKS2 headers without keyslots.
+	VolumeKeySize int
+
+	// DataOffset is the offset of the data area in 512-byte sectors.
+	DataOffset uint64
+	// IVOffset is the IV offset in 512-byte sectors.
+	IVOffset   uint64
+	SectorSize uint32
+
+	DeviceName string
+	// BackingFile is the regular file Init attached to the loop device DeviceName, if any.
+	BackingFile    string
+	MetadataDevice string
+	HeaderDetached bool
+
+	Label     string
+	Subsystem string
+
+	// Integrity is nil if the device does not use authenticated encryption.
+	Integrity *IntegrityParams
+	// PBKDF is the PBKDF used for new keyslots, nil if the device type has none.
+	PBKDF *PbkdfType
+}
+
+// Info gets information about the device's header.
+// Label and Subsystem are left empty if libcryptsetup does not support reading them.
+// Returns the information on success, or an error otherwise.
+func (device *Device) Info() (DeviceInfo, error) {
+	if err := device.lock(); err != nil {
+		return DeviceInfo{}, err
+	}
+	defer device.mux.Unlock()
+
+	cd := device.cryptDevice
+	info := DeviceInfo{
+		Type:           strings.GoString(crypt.GetType(cd)),
+		UUID:           strings.GoString(crypt.GetUUID(cd)),
+		Cipher:         strings.GoString(crypt.GetCipher(cd)),
+		CipherMode:     strings.GoString(crypt.GetCipherMode(cd)),
+		DataOffset:     crypt.GetDataOffset(cd),
+		IVOffset:       crypt.GetIVOffset(cd),
+		DeviceName:     strings.GoString(crypt.GetDeviceName(cd)),
+		MetadataDevice: strings.GoString(crypt.GetMetadataDeviceName(cd)),
+		Label:          strings.GoString(crypt.GetLabel(cd)),
+		Subsystem:      strings.GoString(crypt.GetSubsystem(cd)),
+		BackingFile:    device.backingFile,
+	}
+	if res := crypt.GetSectorSize(cd); res > 0 {
+		info.SectorSize = uint32(res)
+	}
+	if res := crypt.GetVolumeKeySize(cd); res > 0 {
+		info.VolumeKeySize = int(res)
+	}
+
+	if info.Type != CRYPT_LUKS1 && info.Type != CRYPT_LUKS2 {
+		return info, nil
+	}
+
+	switch res := crypt.HeaderIsDetached(cd); {
+	case res == crypt.ENOTSUP:
+		info.HeaderDetached = info.MetadataDevice != ""
+	case res < 0:
+		return DeviceInfo{}, &Error{functionName: "crypt_header_is_detached", code: int(res)}
+	default:
+		info.HeaderDetached = res == 1
+	}
+
+	if pbkdf := crypt.GetPBKDFType(cd); pbkdf != nil {
+		info.PBKDF = &PbkdfType{
+			Type:            strings.GoString(pbkdf.Type),
+			Hash:            strings.GoString(pbkdf.Hash),
+			TimeMs:          pbkdf.TimeMs,
+			Iterations:      pbkdf.Iterations,
+			MaxMemoryKb:     pbkdf.MaxMemoryKb,
+			ParallelThreads: pbkdf.ParallelThreads,
+			Flags:           pbkdf.Flags,
+		}
+	}
+
+	if info.Type == CRYPT_LUKS2 {
+		var cParams crypt.ParamsIntegrity
+		if res := crypt.GetIntegrityInfo(cd, &cParams); res < 0 {
+			return DeviceInfo{}, &Error{functionName: "crypt_get_integrity_info", code: int(res)}
+		}
+		if cParams.Integrity != nil {
+			info.Integrity = &IntegrityParams{
+				Integrity:        strings.GoString(cParams.Integrity),
+				IntegrityKeySize: cParams.IntegrityKeySize,
+				TagSize:          cParams.TagSize,
+				SectorSize:       cParams.SectorSize,
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// DeviceType returns the LUKS1, LUKS2 or Plain value reproducing the described header when passed to Format.
+// Together with GenericParams, it allows formatting another device with the same parameters.
+// The hash of Plain devices is not stored and must be filled in by the caller.
+// Returns an error if the device type is unknown or cannot be reconstructed.
+func (info DeviceInfo) DeviceType() (DeviceType, error) {
+	var dataDevice string
+	if info.HeaderDetached {
+		// The loop device is detached once it is no longer used, unlike its backing file.
+		dataDevice = info.DeviceName
+		if info.BackingFile != "" {
+			dataDevice = info.BackingFile
+		}
+	}
+
+	switch info.Type {
+	case CRYPT_LUKS1:
+		luks1 := LUKS1{DataAlignment: int(info.DataOffset), DataDevice: dataDevice}
+		if info.PBKDF != nil {
+			luks1.Hash = info.PBKDF.Hash
+		}
+		return luks1, nil
+	case CRYPT_LUKS2:
+		luks2 := LUKS2{
+			PBKDFType:     info.PBKDF,
+			DataAlignment: int(info.DataOffset),
+			DataDevice:    dataDevice,
+			SectorSize:    info.SectorSize,
+			Label:         info.Label,
+			Subsystem:     info.Subsystem,
+		}
+		if info.Integrity != nil {
+			luks2.Integrity = info.Integrity.Integrity
+		}
+		return luks2, nil
+	case Plain{}.Name():
+		return Plain{Offset: info.DataOffset, Skip: info.IVOffset, SectorSize: info.SectorSize}, nil
+	default:
+		return nil, fmt.Errorf("cannot reconstruct device type %q", info.Type)
+	}
+}
+
+// GenericParams returns the type independent parameters reproducing the described header when passed to Format.
+// The volume key is not part of the header and must be filled in by the caller.
+func (info DeviceInfo) GenericParams() GenericParams {
+	return GenericParams{
+		Cipher:        info.Cipher,
+		CipherMode:    info.CipherMode,
+		UUID:          info.UUID,
+		VolumeKeySize: info.VolumeKeySize,
+	}
+}
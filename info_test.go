@@ -0,0 +1,119 @@
+package cryptsetup
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Device_Info_LUKS2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	pbkdf := &PbkdfType{Type: "pbkdf2", Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf, SectorSize: 4096, Label: "label"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	_, err = device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	loaded, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer loaded.Free()
+	testWrapper.AssertNoError(loaded.Load(nil))
+
+	info, err := loaded.Info()
+	testWrapper.AssertNoError(err)
+	if info.Type != CRYPT_LUKS2 || info.Cipher != "aes" || info.CipherMode != "xts-plain64" || info.VolumeKeySize != 512/8 {
+		test.Errorf("Unexpected cipher in %+v", info)
+	}
+	if info.UUID != device.GetUUID() || info.DeviceName != loaded.GetDeviceName() || info.BackingFile != loaded.BackingFile() || info.SectorSize != 4096 || info.DataOffset == 0 {
+		test.Errorf("Unexpected header in %+v", info)
+	}
+	if info.HeaderDetached || info.MetadataDevice != "" || info.Integrity != nil {
+		test.Errorf("Unexpected detached header or integrity in %+v", info)
+	}
+	if _, err := loaded.GetLabel(); !errors.Is(err, ErrNotSupported) && info.Label != "label" {
+		test.Errorf("Expected label label, got %q", info.Label)
+	}
+
+	deviceType, err := info.DeviceType()
+	testWrapper.AssertNoError(err)
+	luks2, ok := deviceType.(LUKS2)
+	if !ok {
+		test.Fatalf("Expected LUKS2, got %T", deviceType)
+	}
+	if luks2.SectorSize != 4096 || luks2.DataAlignment != int(info.DataOffset) {
+		test.Errorf("Unexpected LUKS2 %+v", luks2)
+	}
+
+	// Formatting with the reconstructed parameters reproduces the header.
+	genericParams := info.GenericParams()
+	genericParams.UUID = ""
+	device.Free()
+	loaded.Free()
+	reformatted, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer reformatted.Free()
+	testWrapper.AssertNoError(reformatted.Format(deviceType, genericParams))
+
+	reformattedInfo, err := reformatted.Info()
+	testWrapper.AssertNoError(err)
+	if reformattedInfo.DataOffset != info.DataOffset || reformattedInfo.SectorSize != info.SectorSize || reformattedInfo.Cipher != info.Cipher {
+		test.Errorf("Expected %+v, got %+v", info, reformattedInfo)
+	}
+}
+
+func Test_Device_Info_LUKS1(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	info, err := device.Info()
+	testWrapper.AssertNoError(err)
+	if info.Type != CRYPT_LUKS1 || info.VolumeKeySize != 256/8 || info.SectorSize != 512 {
+		test.Errorf("Unexpected info %+v", info)
+	}
+
+	deviceType, err := info.DeviceType()
+	testWrapper.AssertNoError(err)
+	if luks1, ok := deviceType.(LUKS1); !ok || luks1.Hash != "sha256" {
+		test.Errorf("Unexpected device type %+v", deviceType)
+	}
+}
+
+func Test_Device_Info_Plain(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(Plain{Hash: "sha256", Offset: 8, Skip: 16}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	info, err := device.Info()
+	testWrapper.AssertNoError(err)
+	deviceType, err := info.DeviceType()
+	testWrapper.AssertNoError(err)
+	if plain, ok := deviceType.(Plain); !ok || plain.Offset != 8 || plain.Skip != 16 {
+		test.Errorf("Unexpected device type %+v", deviceType)
+	}
+}
+
+func Test_DeviceInfo_DeviceType_Fails_Without_Type(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	info, err := device.Info()
+	testWrapper.AssertNoError(err)
+	_, err = info.DeviceType()
+	testWrapper.AssertError(err)
+}
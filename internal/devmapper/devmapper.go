@@ -0,0 +1,2 @@
+// Package devmapper queries device-mapper devices for state libcryptsetup does not expose.
+package devmapper
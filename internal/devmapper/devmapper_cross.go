@@ -0,0 +1,9 @@
+//go:build !linux
+
+package devmapper
+
+import "errors"
+
+func DeferredRemove(name string) (bool, error) {
+	return false, errors.New("device-mapper is not supported on this platform")
+}
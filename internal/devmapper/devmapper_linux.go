@@ -0,0 +1,63 @@
+//go:build linux
+
+package devmapper
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// dmDevStatus is DM_DEV_STATUS, _IOWR(DM_IOCTL, DM_DEV_STATUS_CMD, struct dm_ioctl) from linux/dm-ioctl.h.
+const dmDevStatus = 0xC138FD07
+
+// dmDeferredRemove is set in dmIoctl.flags if the device is removed once it is closed.
+const dmDeferredRemove = 1 << 17
+
+const (
+	dmNameLen = 128
+	dmUUIDLen = 129
+)
+
+// dmIoctl mirrors struct dm_ioctl.
+type dmIoctl struct {
+	version     [3]uint32
+	dataSize    uint32
+	dataStart   uint32
+	targetCount uint32
+	openCount   int32
+	flags       uint32
+	eventNr     uint32
+	_           uint32
+	dev         uint64
+	name        [dmNameLen]byte
+	uuid        [dmUUIDLen]byte
+	_           [7]byte
+}
+
+// DeferredRemove reports whether the device-mapper device name is scheduled for removal once it is closed.
+// A device that does not exist is not scheduled for removal.
+func DeferredRemove(name string) (bool, error) {
+	if len(name) >= dmNameLen {
+		return false, fmt.Errorf("device-mapper name %q is too long", name)
+	}
+
+	control, err := os.Open("/dev/mapper/control")
+	if err != nil {
+		return false, err
+	}
+	defer control.Close()
+
+	request := dmIoctl{version: [3]uint32{4, 0, 0}, dataSize: uint32(unsafe.Sizeof(dmIoctl{}))}
+	copy(request.name[:], name)
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, control.Fd(), dmDevStatus, uintptr(unsafe.Pointer(&request)))
+	if errno == syscall.ENXIO {
+		return false, nil
+	}
+	if errno != 0 {
+		return false, fmt.Errorf("DM_DEV_STATUS %s: %w", name, errno)
+	}
+	return request.flags&dmDeferredRemove != 0, nil
+}
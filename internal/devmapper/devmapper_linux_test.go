@@ -0,0 +1,37 @@
+//go:build linux
+
+package devmapper
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func Test_dmIoctl_Size(test *testing.T) {
+	if size := unsafe.Sizeof(dmIoctl{}); size != 312 {
+		test.Errorf("Expected struct dm_ioctl to have 312 bytes, got %d", size)
+	}
+}
+
+func Test_DeferredRemove_Missing_Device(test *testing.T) {
+	control, err := os.Open("/dev/mapper/control")
+	if err != nil {
+		test.Skipf("device-mapper is not available: %v", err)
+	}
+	control.Close()
+
+	pending, err := DeferredRemove("purego-cryptsetup-missing")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if pending {
+		test.Error("Expected no deferred removal for a missing device")
+	}
+}
+
+func Test_DeferredRemove_Name_Too_Long(test *testing.T) {
+	if _, err := DeferredRemove(string(make([]byte, dmNameLen))); err == nil {
+		test.Error("Expected an error for a name exceeding the device-mapper limit")
+	}
+}
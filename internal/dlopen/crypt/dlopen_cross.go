@@ -4,6 +4,22 @@ package crypt
 
 import "errors"
 
-func OpenCryptsetup() error {
+func OpenCryptsetup(candidates []string) (string, error) {
+	return "", errors.New("cryptsetup is not supported on this platform")
+}
+
+func NewCallback(fn any) uintptr {
+	panic("cryptsetup is not supported on this platform")
+}
+
+func Install(path, version string, impls map[string]any) error {
 	return errors.New("cryptsetup is not supported on this platform")
 }
+
+func RegisterFunc(fptr any, cfn uintptr) {
+	panic("cryptsetup is not supported on this platform")
+}
+
+func Installed() bool {
+	return false
+}
@@ -3,210 +3,157 @@
 package crypt
 
 import (
-	"sync"
+	"errors"
+	"fmt"
+	"reflect"
 
 	"github.com/ebitengine/purego"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen"
 )
 
-var dlopenMux = sync.Mutex{}
-
 var cryptsetupDL uintptr
 
-const cryptsetupSO = "libcryptsetup.so.12"
+var cryptsetupPath string
 
-func OpenCryptsetup() error {
+// OpenCryptsetup loads the first of the given libcryptsetup candidates that
+// can be opened and provides all required symbols.
+// Returns the path of the loaded library. If libcryptsetup is already loaded,
+// the candidates are ignored.
+func OpenCryptsetup(candidates []string) (string, error) {
 	dlopenMux.Lock()
 	defer dlopenMux.Unlock()
 
-	if cryptsetupDL != 0 {
-		return nil
-	}
-	var err error
-	cryptsetupDL, err = purego.Dlopen(cryptsetupSO, purego.RTLD_NOW|purego.RTLD_GLOBAL)
-	if err != nil {
-		cryptsetupDL = 0
-		return err
-	}
-
-	crypt_init_raw, err := purego.Dlsym(cryptsetupDL, "crypt_init")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_init_dl, crypt_init_raw)
-
-	crypt_init_by_name_raw, err := purego.Dlsym(cryptsetupDL, "crypt_init_by_name")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_init_by_name_dl, crypt_init_by_name_raw)
-
-	crypt_free_raw, err := purego.Dlsym(cryptsetupDL, "crypt_free")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_free_dl, crypt_free_raw)
-
-	crypt_dump_raw, err := purego.Dlsym(cryptsetupDL, "crypt_dump")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_dump_dl, crypt_dump_raw)
-
-	crypt_get_type_raw, err := purego.Dlsym(cryptsetupDL, "crypt_get_type")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_get_type_dl, crypt_get_type_raw)
-
-	crypt_format_raw, err := purego.Dlsym(cryptsetupDL, "crypt_format")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_format_dl, crypt_format_raw)
-
-	crypt_wipe_raw, err := purego.Dlsym(cryptsetupDL, "crypt_wipe")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_wipe_dl, crypt_wipe_raw)
-
-	crypt_resize_raw, err := purego.Dlsym(cryptsetupDL, "crypt_resize")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_resize_dl, crypt_resize_raw)
-
-	crypt_load_raw, err := purego.Dlsym(cryptsetupDL, "crypt_load")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_load_dl, crypt_load_raw)
-
-	crypt_keyslot_add_by_volume_key_raw, err := purego.Dlsym(cryptsetupDL, "crypt_keyslot_add_by_volume_key")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_keyslot_add_by_volume_key_dl, crypt_keyslot_add_by_volume_key_raw)
-
-	crypt_keyslot_add_by_passphrase_raw, err := purego.Dlsym(cryptsetupDL, "crypt_keyslot_add_by_passphrase")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_keyslot_add_by_passphrase_dl, crypt_keyslot_add_by_passphrase_raw)
-
-	crypt_keyslot_change_by_passphrase_raw, err := purego.Dlsym(cryptsetupDL, "crypt_keyslot_change_by_passphrase")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_keyslot_change_by_passphrase_dl, crypt_keyslot_change_by_passphrase_raw)
-
-	crypt_activate_by_passphrase_raw, err := purego.Dlsym(cryptsetupDL, "crypt_activate_by_passphrase")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_activate_by_passphrase_dl, crypt_activate_by_passphrase_raw)
-
-	crypt_activate_by_token_raw, err := purego.Dlsym(cryptsetupDL, "crypt_activate_by_token")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_activate_by_token_dl, crypt_activate_by_token_raw)
-
-	crypt_activate_by_volume_key_raw, err := purego.Dlsym(cryptsetupDL, "crypt_activate_by_volume_key")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_activate_by_volume_key_dl, crypt_activate_by_volume_key_raw)
+	if cryptsetupPath != "" {
+		return cryptsetupPath, nil
+	}
+
+	var errs []error
+	for _, path := range candidates {
+		handle, err := purego.Dlopen(path, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+		if err != nil {
+			errs = append(errs, &dlopen.LoadError{Path: path, Err: err})
+			continue
+		}
+		if err := loadSymbols(handle, path); err != nil {
+			errs = append(errs, err)
+			_ = purego.Dlclose(handle)
+			continue
+		}
+		cryptsetupDL, cryptsetupPath = handle, path
+		return path, nil
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no libcryptsetup candidates given")
+	}
+	return "", errors.Join(errs...)
+}
 
-	crypt_deactivate_raw, err := purego.Dlsym(cryptsetupDL, "crypt_deactivate")
-	if err != nil {
-		return err
+func loadSymbols(cryptsetupDL uintptr, path string) error {
+	// Resolve all symbols before registering any of them,
+	// so a missing required symbol leaves no function half-loaded.
+	addrs := make([]uintptr, len(symbols))
+	for i, sym := range symbols {
+		addr, err := purego.Dlsym(cryptsetupDL, sym.name)
+		if err != nil && sym.required {
+			return &dlopen.LoadError{Path: path, Symbol: sym.name, Err: err}
+		}
+		addrs[i] = addr
 	}
-	purego.RegisterFunc(&crypt_deactivate_dl, crypt_deactivate_raw)
 
-	crypt_set_debug_level_raw, err := purego.Dlsym(cryptsetupDL, "crypt_set_debug_level")
-	if err != nil {
-		return err
+	available := make(map[string]bool, len(symbols))
+	for i, sym := range symbols {
+		if addrs[i] == 0 {
+			continue
+		}
+		purego.RegisterFunc(sym.fptr, addrs[i])
+		available[sym.name] = true
 	}
-	purego.RegisterFunc(&crypt_set_debug_level_dl, crypt_set_debug_level_raw)
 
-	crypt_get_volume_key_size_raw, err := purego.Dlsym(cryptsetupDL, "crypt_get_volume_key_size")
-	if err != nil {
-		return err
+	version := "2.0"
+	for _, probe := range versionProbes {
+		if _, err := purego.Dlsym(cryptsetupDL, probe.symbol); err == nil {
+			version = probe.version
+		}
 	}
-	purego.RegisterFunc(&crypt_get_volume_key_size_dl, crypt_get_volume_key_size_raw)
 
-	crypt_volume_key_get_raw, err := purego.Dlsym(cryptsetupDL, "crypt_volume_key_get")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_volume_key_get_dl, crypt_volume_key_get_raw)
+	availableSymbols, detectedVersion = available, version
+	return nil
+}
 
-	crypt_get_device_name_raw, err := purego.Dlsym(cryptsetupDL, "crypt_get_device_name")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_get_device_name_dl, crypt_get_device_name_raw)
+// Install replaces the bound functions with go implementations instead of loading libcryptsetup.
+// impls maps C function names to go functions with the same signature as the bound function.
+// Required functions without an implementation return -ENOTSUP, optional ones are unavailable.
+// path and version are reported as if a library had been loaded.
+func Install(path, version string, impls map[string]any) error {
+	dlopenMux.Lock()
+	defer dlopenMux.Unlock()
 
-	crypt_get_uuid_raw, err := purego.Dlsym(cryptsetupDL, "crypt_get_uuid")
-	if err != nil {
-		return err
+	if cryptsetupPath != "" {
+		return fmt.Errorf("libcryptsetup is already loaded from '%s'", cryptsetupPath)
 	}
-	purego.RegisterFunc(&crypt_get_uuid_dl, crypt_get_uuid_raw)
 
-	crypt_token_json_get_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_json_get")
-	if err != nil {
-		return err
+	known := make(map[string]bool, len(symbols))
+	for _, sym := range symbols {
+		known[sym.name] = true
 	}
-	purego.RegisterFunc(&crypt_token_json_get_dl, crypt_token_json_get_raw)
-
-	crypt_token_json_set_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_json_set")
-	if err != nil {
-		return err
+	for name, impl := range impls {
+		if !known[name] {
+			return fmt.Errorf("unknown libcryptsetup function '%s'", name)
+		}
+		for _, sym := range symbols {
+			if sym.name == name && !reflect.TypeOf(impl).AssignableTo(reflect.TypeOf(sym.fptr).Elem()) {
+				return fmt.Errorf("implementation of '%s' has type %T", name, impl)
+			}
+		}
 	}
-	purego.RegisterFunc(&crypt_token_json_set_dl, crypt_token_json_set_raw)
 
-	crypt_token_luks2_keyring_get_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_luks2_keyring_get")
-	if err != nil {
-		return err
+	available := make(map[string]bool, len(symbols))
+	for _, sym := range symbols {
+		fn := reflect.ValueOf(sym.fptr).Elem()
+		if impl, ok := impls[sym.name]; ok {
+			fn.Set(reflect.ValueOf(impl))
+			available[sym.name] = true
+		} else if sym.required {
+			fn.Set(reflect.MakeFunc(fn.Type(), notSupported(fn.Type())))
+		} else {
+			fn.Set(reflect.Zero(fn.Type()))
+		}
 	}
-	purego.RegisterFunc(&crypt_token_luks2_keyring_get_dl, crypt_token_luks2_keyring_get_raw)
 
-	crypt_token_luks2_keyring_set_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_luks2_keyring_set")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_token_luks2_keyring_set_dl, crypt_token_luks2_keyring_set_raw)
+	availableSymbols, detectedVersion, cryptsetupPath = available, version, path
+	return nil
+}
 
-	crypt_token_assign_keyslot_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_assign_keyslot")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_token_assign_keyslot_dl, crypt_token_assign_keyslot_raw)
+// Installed reports whether the functions were installed with Install instead of loaded from libcryptsetup.
+func Installed() bool {
+	dlopenMux.Lock()
+	defer dlopenMux.Unlock()
 
-	crypt_token_unassign_keyslot_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_unassign_keyslot")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_token_unassign_keyslot_dl, crypt_token_unassign_keyslot_raw)
+	return cryptsetupPath != "" && cryptsetupDL == 0
+}
 
-	crypt_token_is_assigned_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_is_assigned")
-	if err != nil {
-		return err
+// notSupported implements functions without implementation.
+// It returns -ENOTSUP for int32 results and zero values otherwise.
+func notSupported(fnType reflect.Type) func([]reflect.Value) []reflect.Value {
+	results := make([]reflect.Value, fnType.NumOut())
+	for i := range results {
+		results[i] = reflect.Zero(fnType.Out(i))
+		if fnType.Out(i).Kind() == reflect.Int32 {
+			results[i] = reflect.ValueOf(int32(-95)).Convert(fnType.Out(i))
+		}
 	}
-	purego.RegisterFunc(&crypt_token_is_assigned_dl, crypt_token_is_assigned_raw)
-
-	crypt_token_status_raw, err := purego.Dlsym(cryptsetupDL, "crypt_token_status")
-	if err != nil {
-		return err
+	return func([]reflect.Value) []reflect.Value {
+		return results
 	}
-	purego.RegisterFunc(&crypt_token_status_dl, crypt_token_status_raw)
+}
 
-	crypt_set_log_callback_raw, err := purego.Dlsym(cryptsetupDL, "crypt_set_log_callback")
-	if err != nil {
-		return err
-	}
-	purego.RegisterFunc(&crypt_set_log_callback_dl, crypt_set_log_callback_raw)
+// RegisterFunc binds the C function pointer cfn to the go function pointed to by fptr.
+func RegisterFunc(fptr any, cfn uintptr) {
+	purego.RegisterFunc(fptr, cfn)
+}
 
-	return nil
+// NewCallback converts a go function to a C function pointer that can be passed to libcryptsetup.
+// The callback is never released.
+func NewCallback(fn any) uintptr {
+	return purego.NewCallback(fn)
 }
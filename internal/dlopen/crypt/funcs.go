@@ -45,7 +45,7 @@ func Wipe(
 	length uint64,
 	wipe_block_size uint64,
 	flags uint32,
-	progress unsafe.Pointer,
+	progress uintptr,
 	usrptr unsafe.Pointer,
 ) int32 {
 	return crypt_wipe_dl(cd, dev_path, crypt_wipe_pattern, offset, length, wipe_block_size, flags, progress, usrptr)
@@ -190,3 +190,246 @@ func TokenStatus(cd *CryptDevice, token uint32, typ **byte) int32 {
 func SetLogCallback(cd *CryptDevice, log unsafe.Pointer, usrptr unsafe.Pointer) {
 	crypt_set_log_callback_dl(cd, log, usrptr)
 }
+
+func Log(cd *CryptDevice, level int32, msg *byte) {
+	crypt_log_dl(cd, level, msg)
+}
+
+func TokenRegister(handler *TokenHandler) int32 {
+	return crypt_token_register_dl(handler)
+}
+
+// ENOTSUP is returned by wrappers of optional symbols that are not provided
+// by the loaded libcryptsetup.
+const ENOTSUP = -95
+
+func SetLabel(cd *CryptDevice, label, subsystem *byte) int32 {
+	return crypt_set_label_dl(cd, label, subsystem)
+}
+
+func GetLabel(cd *CryptDevice) *byte {
+	if crypt_get_label_dl == nil {
+		return nil
+	}
+	return crypt_get_label_dl(cd)
+}
+
+func GetSubsystem(cd *CryptDevice) *byte {
+	if crypt_get_subsystem_dl == nil {
+		return nil
+	}
+	return crypt_get_subsystem_dl(cd)
+}
+
+func SetUUID(cd *CryptDevice, uuid *byte) int32 {
+	return crypt_set_uuid_dl(cd, uuid)
+}
+
+func SetMetadataSize(cd *CryptDevice, metadataSize, keyslotsSize uint64) int32 {
+	return crypt_set_metadata_size_dl(cd, metadataSize, keyslotsSize)
+}
+
+func GetMetadataSize(cd *CryptDevice, metadataSize, keyslotsSize *uint64) int32 {
+	return crypt_get_metadata_size_dl(cd, metadataSize, keyslotsSize)
+}
+
+func KeyslotArea(cd *CryptDevice, keyslot int32, offset, length *uint64) int32 {
+	return crypt_keyslot_area_dl(cd, keyslot, offset, length)
+}
+
+func PersistentFlagsSet(cd *CryptDevice, typ uint32, flags uint32) int32 {
+	return crypt_persistent_flags_set_dl(cd, typ, flags)
+}
+
+func PersistentFlagsGet(cd *CryptDevice, typ uint32, flags *uint32) int32 {
+	return crypt_persistent_flags_get_dl(cd, typ, flags)
+}
+
+func GetCipher(cd *CryptDevice) *byte {
+	return crypt_get_cipher_dl(cd)
+}
+
+func GetCipherMode(cd *CryptDevice) *byte {
+	return crypt_get_cipher_mode_dl(cd)
+}
+
+func GetDataOffset(cd *CryptDevice) uint64 {
+	return crypt_get_data_offset_dl(cd)
+}
+
+func GetIVOffset(cd *CryptDevice) uint64 {
+	return crypt_get_iv_offset_dl(cd)
+}
+
+func GetSectorSize(cd *CryptDevice) int32 {
+	return crypt_get_sector_size_dl(cd)
+}
+
+func GetMetadataDeviceName(cd *CryptDevice) *byte {
+	return crypt_get_metadata_device_name_dl(cd)
+}
+
+func GetIntegrityInfo(cd *CryptDevice, ip *ParamsIntegrity) int32 {
+	return crypt_get_integrity_info_dl(cd, ip)
+}
+
+func GetPBKDFType(cd *CryptDevice) *PBKDFType {
+	return crypt_get_pbkdf_type_dl(cd)
+}
+
+func KeyslotStatus(cd *CryptDevice, keyslot int32) int32 {
+	return crypt_keyslot_status_dl(cd, keyslot)
+}
+
+func KeyslotMax(typ *byte) int32 {
+	return crypt_keyslot_max_dl(typ)
+}
+
+func KeyslotGetPBKDF(cd *CryptDevice, keyslot int32, pbkdf *PBKDFType) int32 {
+	return crypt_keyslot_get_pbkdf_dl(cd, keyslot, pbkdf)
+}
+
+func Convert(cd *CryptDevice, typ *byte, params unsafe.Pointer) int32 {
+	return crypt_convert_dl(cd, typ, params)
+}
+
+func HeaderBackup(cd *CryptDevice, requestedType *byte, backupFile *byte) int32 {
+	return crypt_header_backup_dl(cd, requestedType, backupFile)
+}
+
+func HeaderRestore(cd *CryptDevice, requestedType *byte, backupFile *byte) int32 {
+	return crypt_header_restore_dl(cd, requestedType, backupFile)
+}
+
+func Repair(cd *CryptDevice, requestedType *byte, params unsafe.Pointer) int32 {
+	return crypt_repair_dl(cd, requestedType, params)
+}
+
+func VolumeKeyKeyring(cd *CryptDevice, enable int32) int32 {
+	return crypt_volume_key_keyring_dl(cd, enable)
+}
+
+func ActivateByKeyring(cd *CryptDevice, name *byte, keyDescription *byte, keyslot int32, flags uint32) int32 {
+	return crypt_activate_by_keyring_dl(cd, name, keyDescription, keyslot, flags)
+}
+
+func DeactivateByName(cd *CryptDevice, name *byte, flags uint32) int32 {
+	return crypt_deactivate_by_name_dl(cd, name, flags)
+}
+
+func Status(cd *CryptDevice, name *byte) int32 {
+	return crypt_status_dl(cd, name)
+}
+
+func GetActiveDevice(cd *CryptDevice, name *byte, cad *ActiveDevice) int32 {
+	return crypt_get_active_device_dl(cd, name, cad)
+}
+
+func SetRNGType(cd *CryptDevice, rngType int32) {
+	crypt_set_rng_type_dl(cd, rngType)
+}
+
+func GetRNGType(cd *CryptDevice) int32 {
+	return crypt_get_rng_type_dl(cd)
+}
+
+func SetConfirmCallback(cd *CryptDevice, confirm uintptr, usrptr unsafe.Pointer) {
+	crypt_set_confirm_callback_dl(cd, confirm, usrptr)
+}
+
+func ReencryptInitByKeyring(cd *CryptDevice, name *byte, keyDescription *byte, keyslotOld int32, keyslotNew int32, cipher *byte, cipherMode *byte, params *ParamsReencrypt) int32 {
+	if crypt_reencrypt_init_by_keyring_dl == nil {
+		return ENOTSUP
+	}
+	return crypt_reencrypt_init_by_keyring_dl(cd, name, keyDescription, keyslotOld, keyslotNew, cipher, cipherMode, params)
+}
+
+func SetKeyringToLink(cd *CryptDevice, keyDescription *byte, oldKeyDescription *byte, keyTypeDesc *byte, keyringToLinkVK *byte) int32 {
+	if crypt_set_keyring_to_link_dl == nil {
+		return ENOTSUP
+	}
+	return crypt_set_keyring_to_link_dl(cd, keyDescription, oldKeyDescription, keyTypeDesc, keyringToLinkVK)
+}
+
+func ActivateByTokenPIN(
+	cd *CryptDevice,
+	name *byte,
+	typ *byte,
+	token int32,
+	pin *byte,
+	pin_size uint64,
+	usrptr unsafe.Pointer,
+	flags uint32,
+) int32 {
+	if crypt_activate_by_token_pin_dl == nil {
+		return ENOTSUP
+	}
+	return crypt_activate_by_token_pin_dl(cd, name, typ, token, pin, pin_size, usrptr, flags)
+}
+
+func TokenMax(typ *byte) int32 {
+	if crypt_token_max_dl == nil {
+		return ENOTSUP
+	}
+	return crypt_token_max_dl(typ)
+}
+
+func TokenExternalDisable() int32 {
+	if crypt_token_external_disable_dl == nil {
+		return ENOTSUP
+	}
+	crypt_token_external_disable_dl()
+	return 0
+}
+
+func TokenExternalPath() *byte {
+	if crypt_token_external_path_dl == nil {
+		return nil
+	}
+	return crypt_token_external_path_dl()
+}
+
+func ActivateBySignedKey(
+	cd *CryptDevice,
+	name *byte,
+	volume_key *byte,
+	volume_key_size uint64,
+	signature *byte,
+	signature_size uint64,
+	flags uint32,
+) int32 {
+	if crypt_activate_by_signed_key_dl == nil {
+		return ENOTSUP
+	}
+	return crypt_activate_by_signed_key_dl(cd, name, volume_key, volume_key_size, signature, signature_size, flags)
+}
+
+func HeaderIsDetached(cd *CryptDevice) int32 {
+	if crypt_header_is_detached_dl == nil {
+		return ENOTSUP
+	}
+	return crypt_header_is_detached_dl(cd)
+}
+
+// HasSafeAlloc reports whether the safe allocator of libcryptsetup is available.
+// If it is not, SafeAlloc, SafeRealloc, SafeFree and SafeMemzero must not be used.
+func HasSafeAlloc() bool {
+	return crypt_safe_alloc_dl != nil && crypt_safe_free_dl != nil &&
+		crypt_safe_realloc_dl != nil && crypt_safe_memzero_dl != nil
+}
+
+func SafeAlloc(size uint64) unsafe.Pointer {
+	return crypt_safe_alloc_dl(size)
+}
+
+func SafeFree(data unsafe.Pointer) {
+	crypt_safe_free_dl(data)
+}
+
+func SafeRealloc(data unsafe.Pointer, size uint64) unsafe.Pointer {
+	return crypt_safe_realloc_dl(data, size)
+}
+
+func SafeMemzero(data unsafe.Pointer, size uint64) {
+	crypt_safe_memzero_dl(data, size)
+}
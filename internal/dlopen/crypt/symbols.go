@@ -35,6 +35,47 @@ var (
 	crypt_token_is_assigned_dl            crypt_token_is_assigned
 	crypt_token_status_dl                 crypt_token_status
 	crypt_set_log_callback_dl             crypt_set_log_callback
+	crypt_log_dl                          crypt_log
+	crypt_token_register_dl               crypt_token_register
+	crypt_set_label_dl                    crypt_set_label
+	crypt_set_uuid_dl                     crypt_set_uuid
+	crypt_set_metadata_size_dl            crypt_set_metadata_size
+	crypt_get_metadata_size_dl            crypt_get_metadata_size
+	crypt_keyslot_area_dl                 crypt_keyslot_area
+	crypt_persistent_flags_set_dl         crypt_persistent_flags_set
+	crypt_persistent_flags_get_dl         crypt_persistent_flags_get
+	crypt_get_cipher_dl                   crypt_get_cipher
+	crypt_get_cipher_mode_dl              crypt_get_cipher_mode
+	crypt_get_data_offset_dl              crypt_get_data_offset
+	crypt_get_iv_offset_dl                crypt_get_iv_offset
+	crypt_get_sector_size_dl              crypt_get_sector_size
+	crypt_get_metadata_device_name_dl     crypt_get_metadata_device_name
+	crypt_get_integrity_info_dl           crypt_get_integrity_info
+	crypt_get_pbkdf_type_dl               crypt_get_pbkdf_type
+	crypt_keyslot_status_dl               crypt_keyslot_status
+	crypt_keyslot_max_dl                  crypt_keyslot_max
+	crypt_keyslot_get_pbkdf_dl            crypt_keyslot_get_pbkdf
+	crypt_convert_dl                      crypt_convert
+	crypt_header_backup_dl                crypt_header_backup
+	crypt_header_restore_dl               crypt_header_restore
+	crypt_repair_dl                       crypt_repair
+	crypt_volume_key_keyring_dl           crypt_volume_key_keyring
+	crypt_activate_by_keyring_dl          crypt_activate_by_keyring
+	crypt_deactivate_by_name_dl           crypt_deactivate_by_name
+	crypt_status_dl                       crypt_status
+	crypt_get_active_device_dl            crypt_get_active_device
+	crypt_set_rng_type_dl                 crypt_set_rng_type
+	crypt_get_rng_type_dl                 crypt_get_rng_type
+	crypt_set_confirm_callback_dl         crypt_set_confirm_callback
+)
+
+// Safe allocator of libcryptsetup 2.0.
+// It is loaded if available and left nil otherwise, as secrets fall back to libc memory without it.
+var (
+	crypt_safe_alloc_dl   crypt_safe_alloc
+	crypt_safe_free_dl    crypt_safe_free
+	crypt_safe_realloc_dl crypt_safe_realloc
+	crypt_safe_memzero_dl crypt_safe_memzero
 )
 
 type crypt_init func(
@@ -77,7 +118,7 @@ type crypt_wipe func(
 	uint64, // length
 	uint64, // wipe_block_size
 	uint32, // flags
-	unsafe.Pointer, // progress
+	uintptr, // progress
 	unsafe.Pointer, // usrptr
 ) int32
 
@@ -229,6 +270,183 @@ type crypt_set_log_callback func(
 	unsafe.Pointer, // usrptr
 )
 
+type crypt_log func(
+	*CryptDevice, // cd
+	int32, // level
+	*byte, // msg
+)
+
+type crypt_token_register func(
+	*TokenHandler, // handler
+) int32
+
+type crypt_set_label func(
+	*CryptDevice, // cd
+	*byte, // label
+	*byte, // subsystem
+) int32
+
+type crypt_set_uuid func(
+	*CryptDevice, // cd
+	*byte, // uuid
+) int32
+
+type crypt_set_metadata_size func(
+	*CryptDevice, // cd
+	uint64, // metadata_size
+	uint64, // keyslots_size
+) int32
+
+type crypt_get_metadata_size func(
+	*CryptDevice, // cd
+	*uint64, // metadata_size
+	*uint64, // keyslots_size
+) int32
+
+type crypt_keyslot_area func(
+	*CryptDevice, // cd
+	int32, // keyslot
+	*uint64, // offset
+	*uint64, // length
+) int32
+
+type crypt_persistent_flags_set func(
+	*CryptDevice, // cd
+	uint32, // type
+	uint32, // flags
+) int32
+
+type crypt_persistent_flags_get func(
+	*CryptDevice, // cd
+	uint32, // type
+	*uint32, // flags
+) int32
+
+type crypt_get_cipher func(
+	*CryptDevice, // cd
+) *byte
+
+type crypt_get_cipher_mode func(
+	*CryptDevice, // cd
+) *byte
+
+type crypt_get_data_offset func(
+	*CryptDevice, // cd
+) uint64
+
+type crypt_get_iv_offset func(
+	*CryptDevice, // cd
+) uint64
+
+type crypt_get_sector_size func(
+	*CryptDevice, // cd
+) int32
+
+type crypt_get_metadata_device_name func(
+	*CryptDevice, // cd
+) *byte
+
+type crypt_get_integrity_info func(
+	*CryptDevice, // cd
+	*ParamsIntegrity, // ip
+) int32
+
+type crypt_get_pbkdf_type func(
+	*CryptDevice, // cd
+) *PBKDFType
+
+type crypt_keyslot_status func(
+	*CryptDevice, // cd
+	int32, // keyslot
+) int32
+
+type crypt_keyslot_max func(
+	*byte, // type
+) int32
+
+type crypt_keyslot_get_pbkdf func(
+	*CryptDevice, // cd
+	int32, // keyslot
+	*PBKDFType, // pbkdf
+) int32
+
+type crypt_convert func(
+	*CryptDevice, // cd
+	*byte, // type
+	unsafe.Pointer, // params
+) int32
+
+type crypt_header_backup func(
+	*CryptDevice, // cd
+	*byte, // requested_type
+	*byte, // backup_file
+) int32
+
+type crypt_header_restore func(
+	*CryptDevice, // cd
+	*byte, // requested_type
+	*byte, // backup_file
+) int32
+
+type crypt_repair func(
+	*CryptDevice, // cd
+	*byte, // requested_type
+	unsafe.Pointer, // params
+) int32
+
+type crypt_volume_key_keyring func(
+	*CryptDevice, // cd
+	int32, // enable
+) int32
+
+type crypt_activate_by_keyring func(
+	*CryptDevice, // cd
+	*byte, // name
+	*byte, // key_description
+	int32, // keyslot
+	uint32, // flags
+) int32
+
+type crypt_deactivate_by_name func(
+	*CryptDevice, // cd
+	*byte, // name
+	uint32, // flags
+) int32
+
+type crypt_status func(
+	*CryptDevice, // cd
+	*byte, // name
+) int32
+
+type crypt_get_active_device func(
+	*CryptDevice, // cd
+	*byte, // name
+	*ActiveDevice, // cad
+) int32
+
+type crypt_set_rng_type func(
+	*CryptDevice, // cd
+	int32, // rng_type
+)
+
+type crypt_get_rng_type func(
+	*CryptDevice, // cd
+) int32
+
+type crypt_set_confirm_callback func(
+	*CryptDevice, // cd
+	uintptr, // confirm
+	unsafe.Pointer, // usrptr
+)
+
+type ActiveDevice struct {
+	Offset   uint64
+	IVOffset uint64
+	Size     uint64
+	Flags    uint32
+	_        [4]byte
+}
+
 type CryptDevice unsafe.Pointer
 
 // TODO: choose
@@ -244,12 +462,41 @@ type ParamsPlain struct {
 	_          [4]byte
 }
 
+type ParamsVerity struct {
+	HashName       *byte
+	DataDevice     *byte
+	HashDevice     *byte
+	FECDevice      *byte
+	Salt           *byte
+	SaltSize       uint32
+	HashType       uint32
+	DataBlockSize  uint32
+	HashBlockSize  uint32
+	DataSize       uint64
+	HashAreaOffset uint64
+	FECAreaOffset  uint64
+	FECRoots       uint32
+	Flags          uint32
+}
+
 type TokenParamsLUKS2Keyring struct {
 	KeyDescription *byte
 }
 
 const SizeofTokenParamsLUKS2Keyring = unsafe.Sizeof(TokenParamsLUKS2Keyring{})
 
+// TokenHandler mirrors crypt_token_handler.
+// The function fields hold C function pointers.
+type TokenHandler struct {
+	Name       *byte
+	Open       uintptr
+	BufferFree uintptr
+	Validate   uintptr
+	Dump       uintptr
+}
+
+const SizeofTokenHandler = unsafe.Sizeof(TokenHandler{})
+
 type ParamsLUKS1 struct {
 	Hash *byte
 	// TODO: use portable type (size_t)
@@ -304,3 +551,21 @@ type ParamsIntegrity struct {
 }
 
 const SizeofParamsIntegrity = unsafe.Sizeof(ParamsIntegrity{})
+
+type crypt_safe_alloc func(
+	uint64, // size
+) unsafe.Pointer
+
+type crypt_safe_free func(
+	unsafe.Pointer, // data
+)
+
+type crypt_safe_realloc func(
+	unsafe.Pointer, // data
+	uint64, // size
+) unsafe.Pointer
+
+type crypt_safe_memzero func(
+	unsafe.Pointer, // data
+	uint64, // size
+)
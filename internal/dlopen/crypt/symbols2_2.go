@@ -0,0 +1,31 @@
+package crypt
+
+// Symbols introduced in libcryptsetup 2.2.
+// They are loaded if available and left nil otherwise.
+var (
+	crypt_reencrypt_init_by_keyring_dl crypt_reencrypt_init_by_keyring
+)
+
+type crypt_reencrypt_init_by_keyring func(
+	*CryptDevice, // cd
+	*byte, // name
+	*byte, // key_description
+	int32, // keyslot_old
+	int32, // keyslot_new
+	*byte, // cipher
+	*byte, // cipher_mode
+	*ParamsReencrypt, // params
+) int32
+
+type ParamsReencrypt struct {
+	Mode           int32
+	Direction      int32
+	Resilience     *byte
+	Hash           *byte
+	DataShift      uint64
+	MaxHotzoneSize uint64
+	DeviceSize     uint64
+	LUKS2          *ParamsLUKS2
+	Flags          uint32
+	_              [4]byte
+}
@@ -0,0 +1,17 @@
+package crypt
+
+// Symbols introduced in libcryptsetup 2.3.
+// They are loaded if available and left nil otherwise.
+var (
+	crypt_activate_by_signed_key_dl crypt_activate_by_signed_key
+)
+
+type crypt_activate_by_signed_key func(
+	*CryptDevice, // cd
+	*byte, // name
+	*byte, // volume_key
+	uint64, // volume_key_size
+	*byte, // signature
+	uint64, // signature_size
+	uint32, // flags
+) int32
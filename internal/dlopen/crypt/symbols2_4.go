@@ -1,31 +1,43 @@
-//go:build cryptsetup2.4
-
-// TODO: choose if / how those should be loaded
-package dlopen
+package crypt
 
 import "unsafe"
 
+// Symbols introduced in libcryptsetup 2.4.
+// They are loaded if available and left nil otherwise.
+var (
+	crypt_activate_by_token_pin_dl  crypt_activate_by_token_pin
+	crypt_token_max_dl              crypt_token_max
+	crypt_token_external_disable_dl crypt_token_external_disable
+	crypt_token_external_path_dl    crypt_token_external_path
+	crypt_header_is_detached_dl     crypt_header_is_detached
+)
+
+// TODO: choose if / how this should be exposed
 var crypt_dump_json_dl func(
-	*crypt_device, // cd
-	**char, // json
+	*CryptDevice, // cd
+	**byte, // json
 	uint32, // flags
 ) int32
 
-var crypt_activate_by_token_pin_dl func(
-	*crypt_device, // cd
-	*char, // name
-	*char, // type
+type crypt_activate_by_token_pin func(
+	*CryptDevice, // cd
+	*byte, // name
+	*byte, // type
 	int32, // token
-	*char, // pin
-	*uint64, // pin_size
+	*byte, // pin
+	uint64, // pin_size
 	unsafe.Pointer, // usrptr
 	uint32, // flags
 ) int32
 
-var crypt_token_external_disable_dl func()
+type crypt_token_max func(
+	*byte, // type
+) int32
+
+type crypt_token_external_disable func()
 
-var crypt_token_external_path_dl func() *char
+type crypt_token_external_path func() *byte
 
-var crypt_token_max_dl func(
-	*char, //type
+type crypt_header_is_detached func(
+	*CryptDevice, // cd
 ) int32
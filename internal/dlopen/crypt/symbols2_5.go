@@ -0,0 +1,16 @@
+package crypt
+
+// Symbols introduced in libcryptsetup 2.5.
+// They are loaded if available and left nil otherwise.
+var (
+	crypt_get_label_dl     crypt_get_label
+	crypt_get_subsystem_dl crypt_get_subsystem
+)
+
+type crypt_get_label func(
+	*CryptDevice, // cd
+) *byte
+
+type crypt_get_subsystem func(
+	*CryptDevice, // cd
+) *byte
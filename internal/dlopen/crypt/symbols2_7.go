@@ -0,0 +1,15 @@
+package crypt
+
+// Symbols introduced in libcryptsetup 2.7.
+// They are loaded if available and left nil otherwise.
+var (
+	crypt_set_keyring_to_link_dl crypt_set_keyring_to_link
+)
+
+type crypt_set_keyring_to_link func(
+	*CryptDevice, // cd
+	*byte, // key_description
+	*byte, // old_key_description
+	*byte, // key_type_desc
+	*byte, // keyring_to_link_vk
+) int32
@@ -0,0 +1,168 @@
+package crypt
+
+import "sync"
+
+var dlopenMux = sync.Mutex{}
+
+// symbol describes a libcryptsetup function and the variable it is registered to.
+type symbol struct {
+	name     string
+	fptr     any
+	required bool
+}
+
+var symbols = []symbol{
+	{"crypt_init", &crypt_init_dl, true},
+	{"crypt_init_by_name", &crypt_init_by_name_dl, true},
+	{"crypt_free", &crypt_free_dl, true},
+	{"crypt_dump", &crypt_dump_dl, true},
+	{"crypt_get_type", &crypt_get_type_dl, true},
+	{"crypt_format", &crypt_format_dl, true},
+	{"crypt_wipe", &crypt_wipe_dl, true},
+	{"crypt_resize", &crypt_resize_dl, true},
+	{"crypt_load", &crypt_load_dl, true},
+	{"crypt_keyslot_add_by_volume_key", &crypt_keyslot_add_by_volume_key_dl, true},
+	{"crypt_keyslot_add_by_passphrase", &crypt_keyslot_add_by_passphrase_dl, true},
+	{"crypt_keyslot_change_by_passphrase", &crypt_keyslot_change_by_passphrase_dl, true},
+	{"crypt_activate_by_passphrase", &crypt_activate_by_passphrase_dl, true},
+	{"crypt_activate_by_token", &crypt_activate_by_token_dl, true},
+	{"crypt_activate_by_volume_key", &crypt_activate_by_volume_key_dl, true},
+	{"crypt_deactivate", &crypt_deactivate_dl, true},
+	{"crypt_set_debug_level", &crypt_set_debug_level_dl, true},
+	{"crypt_get_volume_key_size", &crypt_get_volume_key_size_dl, true},
+	{"crypt_volume_key_get", &crypt_volume_key_get_dl, true},
+	{"crypt_get_device_name", &crypt_get_device_name_dl, true},
+	{"crypt_get_uuid", &crypt_get_uuid_dl, true},
+	{"crypt_token_json_get", &crypt_token_json_get_dl, true},
+	{"crypt_token_json_set", &crypt_token_json_set_dl, true},
+	{"crypt_token_luks2_keyring_get", &crypt_token_luks2_keyring_get_dl, true},
+	{"crypt_token_luks2_keyring_set", &crypt_token_luks2_keyring_set_dl, true},
+	{"crypt_token_assign_keyslot", &crypt_token_assign_keyslot_dl, true},
+	{"crypt_token_unassign_keyslot", &crypt_token_unassign_keyslot_dl, true},
+	{"crypt_token_is_assigned", &crypt_token_is_assigned_dl, true},
+	{"crypt_token_status", &crypt_token_status_dl, true},
+	{"crypt_set_log_callback", &crypt_set_log_callback_dl, true},
+	{"crypt_log", &crypt_log_dl, true},
+	{"crypt_token_register", &crypt_token_register_dl, true},
+	{"crypt_set_label", &crypt_set_label_dl, true},
+	{"crypt_set_uuid", &crypt_set_uuid_dl, true},
+	{"crypt_set_metadata_size", &crypt_set_metadata_size_dl, true},
+	{"crypt_get_metadata_size", &crypt_get_metadata_size_dl, true},
+	{"crypt_keyslot_area", &crypt_keyslot_area_dl, true},
+	{"crypt_persistent_flags_set", &crypt_persistent_flags_set_dl, true},
+	{"crypt_persistent_flags_get", &crypt_persistent_flags_get_dl, true},
+	{"crypt_get_cipher", &crypt_get_cipher_dl, true},
+	{"crypt_get_cipher_mode", &crypt_get_cipher_mode_dl, true},
+	{"crypt_get_data_offset", &crypt_get_data_offset_dl, true},
+	{"crypt_get_iv_offset", &crypt_get_iv_offset_dl, true},
+	{"crypt_get_sector_size", &crypt_get_sector_size_dl, true},
+	{"crypt_get_metadata_device_name", &crypt_get_metadata_device_name_dl, true},
+	{"crypt_get_integrity_info", &crypt_get_integrity_info_dl, true},
+	{"crypt_get_pbkdf_type", &crypt_get_pbkdf_type_dl, true},
+	{"crypt_keyslot_status", &crypt_keyslot_status_dl, true},
+	{"crypt_keyslot_max", &crypt_keyslot_max_dl, true},
+	{"crypt_keyslot_get_pbkdf", &crypt_keyslot_get_pbkdf_dl, true},
+	{"crypt_convert", &crypt_convert_dl, true},
+	{"crypt_header_backup", &crypt_header_backup_dl, true},
+	{"crypt_header_restore", &crypt_header_restore_dl, true},
+	{"crypt_repair", &crypt_repair_dl, true},
+	{"crypt_volume_key_keyring", &crypt_volume_key_keyring_dl, true},
+	{"crypt_activate_by_keyring", &crypt_activate_by_keyring_dl, true},
+	{"crypt_deactivate_by_name", &crypt_deactivate_by_name_dl, true},
+	{"crypt_status", &crypt_status_dl, true},
+	{"crypt_get_active_device", &crypt_get_active_device_dl, true},
+	{"crypt_set_rng_type", &crypt_set_rng_type_dl, true},
+	{"crypt_get_rng_type", &crypt_get_rng_type_dl, true},
+	{"crypt_set_confirm_callback", &crypt_set_confirm_callback_dl, true},
+
+	// optional symbols (libcryptsetup >= 2.0)
+	{"crypt_safe_alloc", &crypt_safe_alloc_dl, false},
+	{"crypt_safe_free", &crypt_safe_free_dl, false},
+	{"crypt_safe_realloc", &crypt_safe_realloc_dl, false},
+	{"crypt_safe_memzero", &crypt_safe_memzero_dl, false},
+
+	// optional symbols (libcryptsetup >= 2.2)
+	{"crypt_reencrypt_init_by_keyring", &crypt_reencrypt_init_by_keyring_dl, false},
+
+	// optional symbols (libcryptsetup >= 2.3)
+	{"crypt_activate_by_signed_key", &crypt_activate_by_signed_key_dl, false},
+
+	// optional symbols (libcryptsetup >= 2.4)
+	{"crypt_activate_by_token_pin", &crypt_activate_by_token_pin_dl, false},
+	{"crypt_token_max", &crypt_token_max_dl, false},
+	{"crypt_token_external_disable", &crypt_token_external_disable_dl, false},
+	{"crypt_token_external_path", &crypt_token_external_path_dl, false},
+	{"crypt_header_is_detached", &crypt_header_is_detached_dl, false},
+
+	// optional symbols (libcryptsetup >= 2.5)
+	{"crypt_get_label", &crypt_get_label_dl, false},
+	{"crypt_get_subsystem", &crypt_get_subsystem_dl, false},
+
+	// optional symbols (libcryptsetup >= 2.7)
+	{"crypt_set_keyring_to_link", &crypt_set_keyring_to_link_dl, false},
+}
+
+// versionProbes are symbols first exported by a libcryptsetup version, in ascending order.
+// libcryptsetup does not export its version, so it is derived from these.
+var versionProbes = []struct {
+	version string
+	symbol  string
+}{
+	{"2.2", "crypt_reencrypt_init_by_passphrase"},
+	{"2.3", "crypt_activate_by_signed_key"},
+	{"2.4", "crypt_activate_by_token_pin"},
+	{"2.5", "crypt_get_label"},
+	{"2.6", "crypt_keyslot_context_init_by_passphrase"},
+	{"2.7", "crypt_set_keyring_to_link"},
+}
+
+var (
+	availableSymbols map[string]bool
+	detectedVersion  string
+)
+
+// Available reports whether the loaded libcryptsetup provides the function.
+func Available(name string) bool {
+	dlopenMux.Lock()
+	defer dlopenMux.Unlock()
+
+	return availableSymbols[name]
+}
+
+// Symbols returns the availability of all bound functions.
+func Symbols() map[string]bool {
+	dlopenMux.Lock()
+	defer dlopenMux.Unlock()
+
+	res := make(map[string]bool, len(symbols))
+	for _, sym := range symbols {
+		res[sym.name] = availableSymbols[sym.name]
+	}
+	return res
+}
+
+// VersionAtLeast reports whether the detected libcryptsetup version is at least version, e.g. "2.6".
+func VersionAtLeast(version string) bool {
+	dlopenMux.Lock()
+	defer dlopenMux.Unlock()
+
+	detected, required := -1, -1
+	for index, probe := range versionProbes {
+		if probe.version == detectedVersion {
+			detected = index
+		}
+		if probe.version == version {
+			required = index
+		}
+	}
+	return detected >= 0 && required >= 0 && detected >= required
+}
+
+// Version returns the minimal libcryptsetup version providing all exported symbols,
+// or an empty string if libcryptsetup is not loaded.
+func Version() string {
+	dlopenMux.Lock()
+	defer dlopenMux.Unlock()
+
+	return detectedVersion
+}
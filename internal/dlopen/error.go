@@ -0,0 +1,24 @@
+package dlopen
+
+import "fmt"
+
+// LoadError reports a shared library or a symbol that could not be loaded.
+type LoadError struct {
+	// Path is the file name or path passed to dlopen.
+	Path string
+	// Symbol is the symbol that could not be resolved.
+	// It is empty if the library itself could not be opened.
+	Symbol string
+	Err    error
+}
+
+func (e *LoadError) Error() string {
+	if e.Symbol != "" {
+		return fmt.Sprintf("loading symbol '%s' from '%s': %v", e.Symbol, e.Path, e.Err)
+	}
+	return fmt.Sprintf("loading '%s': %v", e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
@@ -4,6 +4,6 @@ package libc
 
 import "errors"
 
-func OpenLibc() error {
-	return errors.New("libc is not supported on this platform")
+func OpenLibc(candidates []string) (string, error) {
+	return "", errors.New("libc is not supported on this platform")
 }
@@ -3,60 +3,94 @@
 package libc
 
 import (
+	"errors"
 	"sync"
 
 	"github.com/ebitengine/purego"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen"
 )
 
 var dlopenMux = sync.Mutex{}
 
 var libcDL uintptr
 
-const libcSO = "libc.so.6"
+var libcPath string
 
-func OpenLibc() error {
+// OpenLibc loads the first of the given libc candidates that can be opened
+// and provides all required symbols.
+// Returns the path of the loaded library. If libc is already loaded,
+// the candidates are ignored.
+func OpenLibc(candidates []string) (string, error) {
 	dlopenMux.Lock()
 	defer dlopenMux.Unlock()
 
 	if libcDL != 0 {
-		return nil
+		return libcPath, nil
 	}
-	var err error
-	libcDL, err = purego.Dlopen(libcSO, purego.RTLD_NOW|purego.RTLD_GLOBAL)
-	if err != nil {
-		libcDL = 0
-		return err
+
+	var errs []error
+	for _, path := range candidates {
+		handle, err := purego.Dlopen(path, purego.RTLD_NOW|purego.RTLD_GLOBAL)
+		if err != nil {
+			errs = append(errs, &dlopen.LoadError{Path: path, Err: err})
+			continue
+		}
+		if err := loadSymbols(handle, path); err != nil {
+			errs = append(errs, err)
+			_ = purego.Dlclose(handle)
+			continue
+		}
+		libcDL, libcPath = handle, path
+		return path, nil
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no libc candidates given")
 	}
+	return "", errors.Join(errs...)
+}
 
+func loadSymbols(libcDL uintptr, path string) error {
 	malloc_raw, err := purego.Dlsym(libcDL, "malloc")
 	if err != nil {
-		return err
+		return &dlopen.LoadError{Path: path, Symbol: "malloc", Err: err}
 	}
 	purego.RegisterFunc(&malloc_dl, malloc_raw)
 
 	free_raw, err := purego.Dlsym(libcDL, "free")
 	if err != nil {
-		return err
+		return &dlopen.LoadError{Path: path, Symbol: "free", Err: err}
 	}
 	purego.RegisterFunc(&free_dl, free_raw)
 
 	memcpy, err := purego.Dlsym(libcDL, "memcpy")
 	if err != nil {
-		return err
+		return &dlopen.LoadError{Path: path, Symbol: "memcpy", Err: err}
 	}
 	purego.RegisterFunc(&memcpy_dl, memcpy)
 
 	strlen, err := purego.Dlsym(libcDL, "strlen")
 	if err != nil {
-		return err
+		return &dlopen.LoadError{Path: path, Symbol: "strlen", Err: err}
 	}
 	purego.RegisterFunc(&strlen_dl, strlen)
 
 	strncpy, err := purego.Dlsym(libcDL, "strncpy")
 	if err != nil {
-		return err
+		return &dlopen.LoadError{Path: path, Symbol: "strncpy", Err: err}
 	}
 	purego.RegisterFunc(&strncpy_dl, strncpy)
 
+	mlock, err := purego.Dlsym(libcDL, "mlock")
+	if err != nil {
+		return &dlopen.LoadError{Path: path, Symbol: "mlock", Err: err}
+	}
+	purego.RegisterFunc(&mlock_dl, mlock)
+
+	munlock, err := purego.Dlsym(libcDL, "munlock")
+	if err != nil {
+		return &dlopen.LoadError{Path: path, Symbol: "munlock", Err: err}
+	}
+	purego.RegisterFunc(&munlock_dl, munlock)
+
 	return nil
 }
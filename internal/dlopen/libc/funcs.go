@@ -21,3 +21,11 @@ func Strlen(s *byte) uint64 {
 func Strncpy(dst, src *byte, size uint64) {
 	strncpy_dl(dst, src, size)
 }
+
+func Mlock(addr unsafe.Pointer, size uint64) int32 {
+	return mlock_dl(addr, size)
+}
+
+func Munlock(addr unsafe.Pointer, size uint64) int32 {
+	return munlock_dl(addr, size)
+}
@@ -8,6 +8,8 @@ var (
 	memcpy_dl  memcpy
 	strlen_dl  strlen
 	strncpy_dl strncpy
+	mlock_dl   mlock
+	munlock_dl munlock
 )
 
 type malloc func(size uint64) unsafe.Pointer
@@ -15,3 +17,5 @@ type free func(ptr unsafe.Pointer)
 type memcpy func(dst, src unsafe.Pointer, size uint64)
 type strlen func(s *byte) uint64
 type strncpy func(dst, src *byte, size uint64)
+type mlock func(addr unsafe.Pointer, size uint64) int32
+type munlock func(addr unsafe.Pointer, size uint64) int32
@@ -0,0 +1,151 @@
+package strings
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/libc"
+)
+
+// secretHeader precedes every secret allocated by SecretAlloc.
+// It records the allocator, so a secret is freed by the allocator it came from,
+// even if the availability of the safe allocator changes in between.
+type secretHeader struct {
+	size uint64
+	safe bool
+	_    [7]byte
+}
+
+// secretHeaderSize keeps the secret itself 16 byte aligned.
+const secretHeaderSize = uint64(unsafe.Sizeof(secretHeader{}))
+
+// SecretAlloc allocates zeroed C memory for secrets.
+// It uses libcryptsetup's safe allocator if available and falls back to
+// mlock-ed libc memory otherwise.
+// The caller is responsible for calling SecretFree on the returned pointer when done.
+func SecretAlloc(size uint64) unsafe.Pointer {
+	safe := crypt.HasSafeAlloc()
+
+	var alloc unsafe.Pointer
+	if safe {
+		alloc = crypt.SafeAlloc(secretHeaderSize + size)
+	} else {
+		alloc = libc.Malloc(secretHeaderSize + size)
+	}
+	if alloc == nil {
+		return nil
+	}
+	*(*secretHeader)(alloc) = secretHeader{size: size, safe: safe}
+	ptr := unsafe.Add(alloc, secretHeaderSize)
+	if !safe {
+		Zero(ptr, size)
+		lockPages(ptr, size)
+	}
+	return ptr
+}
+
+// SecretFree zeroes and frees memory allocated by SecretAlloc.
+func SecretFree(ptr unsafe.Pointer) {
+	if ptr == nil {
+		return
+	}
+
+	alloc := unsafe.Add(ptr, -int(secretHeaderSize))
+	header := *(*secretHeader)(alloc)
+	if header.safe {
+		crypt.SafeFree(alloc)
+		return
+	}
+
+	Zero(ptr, header.size)
+	unlockPages(ptr, header.size)
+	libc.Free(alloc)
+}
+
+var (
+	lockedPagesMux = sync.Mutex{}
+	// lockedPages counts the live secrets on each page locked by the fallback allocator.
+	// Locks do not nest, so a page is only unlocked when no secret uses it anymore.
+	lockedPages = map[uintptr]int{}
+)
+
+// lockPages locks the pages holding a secret in memory.
+func lockPages(ptr unsafe.Pointer, size uint64) {
+	lockedPagesMux.Lock()
+	defer lockedPagesMux.Unlock()
+
+	// Locking may fail due to RLIMIT_MEMLOCK, which is not fatal.
+	libc.Mlock(ptr, size)
+	for _, page := range pages(ptr, size) {
+		lockedPages[uintptr(page)]++
+	}
+}
+
+// unlockPages unlocks the pages holding a freed secret that are not shared with other secrets.
+func unlockPages(ptr unsafe.Pointer, size uint64) {
+	lockedPagesMux.Lock()
+	defer lockedPagesMux.Unlock()
+
+	pageSize := uint64(os.Getpagesize())
+	for _, page := range pages(ptr, size) {
+		if lockedPages[uintptr(page)]--; lockedPages[uintptr(page)] > 0 {
+			continue
+		}
+		delete(lockedPages, uintptr(page))
+		libc.Munlock(page, pageSize)
+	}
+}
+
+// pages returns the start of each page overlapping size bytes at ptr.
+func pages(ptr unsafe.Pointer, size uint64) []unsafe.Pointer {
+	pageSize := uintptr(os.Getpagesize())
+	first := unsafe.Add(ptr, -int(uintptr(ptr)%pageSize))
+	count := (uintptr(ptr)%pageSize + uintptr(size) + pageSize - 1) / pageSize
+
+	res := make([]unsafe.Pointer, count)
+	for i := range res {
+		res[i] = unsafe.Add(first, i*int(pageSize))
+	}
+	return res
+}
+
+// SecretZero overwrites size bytes of C memory starting at ptr with zeroes.
+func SecretZero(ptr unsafe.Pointer, size uint64) {
+	if crypt.HasSafeAlloc() {
+		crypt.SafeMemzero(ptr, size)
+		return
+	}
+	Zero(ptr, size)
+}
+
+// CSecret copies a secret to NUL-terminated C memory allocated by SecretAlloc.
+// The caller is responsible for calling CSecretFree on the returned pointer when done.
+func CSecret(secret []byte) *byte {
+	buf := SecretAlloc(uint64(len(secret) + 1))
+	if buf == nil {
+		return nil
+	}
+	if len(secret) > 0 {
+		libc.Memcpy(buf, unsafe.Pointer(&secret[0]), uint64(len(secret)))
+	}
+	return (*byte)(buf)
+}
+
+// CSecretString is like CSecret, but copies a go string without an intermediate copy.
+func CSecretString(secret string) *byte {
+	buf := SecretAlloc(uint64(len(secret) + 1))
+	if buf == nil {
+		return nil
+	}
+	for i := 0; i < len(secret); i++ {
+		*(*byte)(unsafe.Pointer(uintptr(buf) + uintptr(i))) = secret[i]
+	}
+	return (*byte)(buf)
+}
+
+// CSecretFree zeroes and frees a pointer allocated by CSecret or CSecretString.
+func CSecretFree(ptr *byte) {
+	SecretFree(unsafe.Pointer(ptr))
+}
@@ -30,6 +30,13 @@ func CFree(ptr *byte) {
 	libc.Free(unsafe.Pointer(ptr))
 }
 
+// Zero overwrites size bytes of C memory starting at ptr with zeroes.
+func Zero(ptr unsafe.Pointer, size uint64) {
+	for i := uint64(0); i < size; i++ {
+		*(*byte)(unsafe.Pointer(uintptr(ptr) + uintptr(i))) = 0
+	}
+}
+
 func PtrFree(ptr unsafe.Pointer) {
 	libc.Free(ptr)
 }
@@ -43,6 +50,9 @@ func GoString(name *byte) string {
 		return ""
 	}
 	l := libc.Strlen(name)
+	if l == 0 {
+		return ""
+	}
 	buf := make([]byte, l)
 	libc.Memcpy(unsafe.Pointer(&buf[0]), unsafe.Pointer(name), l)
 	return string(buf)
@@ -50,6 +60,9 @@ func GoString(name *byte) string {
 
 func GoBytes(name *byte, size uint64) []byte {
 	buf := make([]byte, size)
+	if size == 0 {
+		return buf
+	}
 	libc.Memcpy(unsafe.Pointer(&buf[0]), unsafe.Pointer(name), size)
 	return buf
 }
@@ -0,0 +1,63 @@
+// Package keyctl manages keys in the Linux kernel keyring.
+// It talks to the kernel's key management facility directly and does not require keyutils.
+package keyctl
+
+// Serial identifies a key or keyring.
+type Serial int32
+
+// Special keyrings, which are resolved relative to the calling thread.
+const (
+	ThreadKeyring      Serial = -1
+	ProcessKeyring     Serial = -2
+	SessionKeyring     Serial = -3
+	UserKeyring        Serial = -4
+	UserSessionKeyring Serial = -5
+)
+
+// Key types used by libcryptsetup.
+const (
+	// TypeUser is the type of keys holding passphrases.
+	TypeUser = "user"
+	// TypeLogon is the type of keys holding volume keys, which cannot be read back from user space.
+	TypeLogon = "logon"
+	// TypeKeyring is the type of keyrings.
+	TypeKeyring = "keyring"
+)
+
+// Perm is a key permission mask, made of a view, read, write, search, link and setattr bit for the possessor, the user, the group and others.
+type Perm uint32
+
+// Permissions of the possessor, the owning user, the owning group and others.
+const (
+	PosView    Perm = 0x01000000
+	PosRead    Perm = 0x02000000
+	PosWrite   Perm = 0x04000000
+	PosSearch  Perm = 0x08000000
+	PosLink    Perm = 0x10000000
+	PosSetattr Perm = 0x20000000
+	PosAll     Perm = 0x3f000000
+
+	UsrView    Perm = 0x00010000
+	UsrRead    Perm = 0x00020000
+	UsrWrite   Perm = 0x00040000
+	UsrSearch  Perm = 0x00080000
+	UsrLink    Perm = 0x00100000
+	UsrSetattr Perm = 0x00200000
+	UsrAll     Perm = 0x003f0000
+
+	GrpView    Perm = 0x00000100
+	GrpRead    Perm = 0x00000200
+	GrpWrite   Perm = 0x00000400
+	GrpSearch  Perm = 0x00000800
+	GrpLink    Perm = 0x00001000
+	GrpSetattr Perm = 0x00002000
+	GrpAll     Perm = 0x00003f00
+
+	OthView    Perm = 0x00000001
+	OthRead    Perm = 0x00000002
+	OthWrite   Perm = 0x00000004
+	OthSearch  Perm = 0x00000008
+	OthLink    Perm = 0x00000010
+	OthSetattr Perm = 0x00000020
+	OthAll     Perm = 0x0000003f
+)
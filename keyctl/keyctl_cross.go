@@ -0,0 +1,39 @@
+//go:build !linux
+
+package keyctl
+
+import "errors"
+
+var errNotSupported = errors.New("the kernel keyring is not supported on this platform")
+
+func AddKey(keyType, description string, payload []byte, keyring Serial) (Serial, error) {
+	return 0, errNotSupported
+}
+
+func RequestKey(keyType, description string, keyring Serial) (Serial, error) {
+	return 0, errNotSupported
+}
+
+func Search(keyring Serial, keyType, description string) (Serial, error) {
+	return 0, errNotSupported
+}
+
+func KeyringID(keyring Serial, create bool) (Serial, error) {
+	return 0, errNotSupported
+}
+
+func Read(key Serial) ([]byte, error) {
+	return nil, errNotSupported
+}
+
+func Unlink(key, keyring Serial) error {
+	return errNotSupported
+}
+
+func Revoke(key Serial) error {
+	return errNotSupported
+}
+
+func SetPerm(key Serial, perm Perm) error {
+	return errNotSupported
+}
@@ -0,0 +1,149 @@
+//go:build linux
+
+package keyctl
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// keyctl operations from linux/keyctl.h.
+const (
+	keyctlGetKeyringID = 0
+	keyctlRevoke       = 3
+	keyctlSetperm      = 5
+	keyctlUnlink       = 9
+	keyctlSearch       = 10
+	keyctlRead         = 11
+)
+
+// AddKey adds a key with the payload to the keyring, or updates the payload of an existing key with the same type and description.
+// Returns the serial of the key on success, or an error otherwise.
+func AddKey(keyType, description string, payload []byte, keyring Serial) (Serial, error) {
+	cKeyType, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	cDescription, err := syscall.BytePtrFromString(description)
+	if err != nil {
+		return 0, err
+	}
+	var cPayload unsafe.Pointer
+	if len(payload) > 0 {
+		cPayload = unsafe.Pointer(&payload[0])
+	}
+
+	serial, _, errno := syscall.Syscall6(syscall.SYS_ADD_KEY,
+		uintptr(unsafe.Pointer(cKeyType)), uintptr(unsafe.Pointer(cDescription)),
+		uintptr(cPayload), uintptr(len(payload)), uintptr(keyring), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return Serial(serial), nil
+}
+
+// RequestKey searches the thread, process and session keyrings for a key with the type and description.
+// If keyring is not 0, the found key is linked into it.
+// Returns the serial of the key on success, or an error otherwise.
+func RequestKey(keyType, description string, keyring Serial) (Serial, error) {
+	cKeyType, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	cDescription, err := syscall.BytePtrFromString(description)
+	if err != nil {
+		return 0, err
+	}
+
+	serial, _, errno := syscall.Syscall6(syscall.SYS_REQUEST_KEY,
+		uintptr(unsafe.Pointer(cKeyType)), uintptr(unsafe.Pointer(cDescription)),
+		0, uintptr(keyring), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return Serial(serial), nil
+}
+
+// Search searches the keyring and the keyrings linked to it for a key with the type and description.
+// Returns the serial of the key on success, or an error otherwise, e.g. syscall.ENOKEY if there is none.
+func Search(keyring Serial, keyType, description string) (Serial, error) {
+	cKeyType, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	cDescription, err := syscall.BytePtrFromString(description)
+	if err != nil {
+		return 0, err
+	}
+
+	serial, err := keyctl(keyctlSearch, uintptr(keyring), uintptr(unsafe.Pointer(cKeyType)), uintptr(unsafe.Pointer(cDescription)), 0)
+	runtime.KeepAlive(cKeyType)
+	runtime.KeepAlive(cDescription)
+	return Serial(serial), err
+}
+
+// KeyringID resolves a special keyring like SessionKeyring to its serial, creating the keyring if create is true.
+// Returns the serial on success, or an error otherwise.
+func KeyringID(keyring Serial, create bool) (Serial, error) {
+	var cCreate uintptr
+	if create {
+		cCreate = 1
+	}
+	serial, err := keyctl(keyctlGetKeyringID, uintptr(keyring), cCreate, 0, 0)
+	return Serial(serial), err
+}
+
+// Read reads the payload of a key, which requires read permission.
+// Returns the payload on success, or an error otherwise.
+func Read(key Serial) ([]byte, error) {
+	for {
+		size, err := keyctl(keyctlRead, uintptr(key), 0, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return []byte{}, nil
+		}
+
+		payload := make([]byte, size)
+		read, err := keyctl(keyctlRead, uintptr(key), uintptr(unsafe.Pointer(&payload[0])), uintptr(size), 0)
+		runtime.KeepAlive(payload)
+		if err != nil {
+			return nil, err
+		}
+		// The payload may have grown in between.
+		if read <= size {
+			return payload[:read], nil
+		}
+	}
+}
+
+// Unlink removes the link to a key from the keyring; the key is destroyed once it is not linked anymore.
+// Returns nil on success, or an error otherwise.
+func Unlink(key, keyring Serial) error {
+	_, err := keyctl(keyctlUnlink, uintptr(key), uintptr(keyring), 0, 0)
+	return err
+}
+
+// Revoke revokes a key, so it cannot be found or read anymore even while it is still linked.
+// Returns nil on success, or an error otherwise.
+func Revoke(key Serial) error {
+	_, err := keyctl(keyctlRevoke, uintptr(key), 0, 0, 0)
+	return err
+}
+
+// SetPerm sets the permissions of a key.
+// Returns nil on success, or an error otherwise.
+func SetPerm(key Serial, perm Perm) error {
+	_, err := keyctl(keyctlSetperm, uintptr(key), uintptr(perm), 0, 0)
+	return err
+}
+
+func keyctl(operation, arg2, arg3, arg4, arg5 uintptr) (int, error) {
+	res, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, operation, arg2, arg3, arg4, arg5, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(res), nil
+}
@@ -0,0 +1,133 @@
+//go:build linux
+
+package keyctl
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func Test_AddKey_Read_Unlink(test *testing.T) {
+	keyring, err := KeyringID(ProcessKeyring, true)
+	if err != nil {
+		test.Skipf("kernel keyring is not available: %v", err)
+	}
+
+	payload := []byte("passphrase")
+	key, err := AddKey(TypeUser, "keyctl-test:read", payload, keyring)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	read, err := Read(key)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !bytes.Equal(read, payload) {
+		test.Errorf("Expected payload %q, got %q", payload, read)
+	}
+
+	found, err := RequestKey(TypeUser, "keyctl-test:read", 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if found != key {
+		test.Errorf("Expected key %d, got %d", key, found)
+	}
+
+	if err := Unlink(key, keyring); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := RequestKey(TypeUser, "keyctl-test:read", 0); !errors.Is(err, syscall.ENOKEY) {
+		test.Errorf("Expected ENOKEY after unlink, got %v", err)
+	}
+}
+
+func Test_Search(test *testing.T) {
+	keyring, err := KeyringID(ProcessKeyring, true)
+	if err != nil {
+		test.Skipf("kernel keyring is not available: %v", err)
+	}
+
+	key, err := AddKey(TypeUser, "keyctl-test:search", []byte("secret"), keyring)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	found, err := Search(ProcessKeyring, TypeUser, "keyctl-test:search")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if found != key {
+		test.Errorf("Expected key %d, got %d", key, found)
+	}
+	if _, err := Search(ProcessKeyring, TypeLogon, "keyctl-test:search"); !errors.Is(err, syscall.ENOKEY) {
+		test.Errorf("Expected ENOKEY for another key type, got %v", err)
+	}
+
+	if err := Unlink(key, keyring); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := Search(ProcessKeyring, TypeUser, "keyctl-test:search"); !errors.Is(err, syscall.ENOKEY) {
+		test.Errorf("Expected ENOKEY after unlink, got %v", err)
+	}
+}
+
+func Test_Logon_Key_Cannot_Be_Read(test *testing.T) {
+	keyring, err := KeyringID(ProcessKeyring, true)
+	if err != nil {
+		test.Skipf("kernel keyring is not available: %v", err)
+	}
+
+	key, err := AddKey(TypeLogon, "keyctl-test:logon", []byte("volume key"), keyring)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer Unlink(key, keyring)
+
+	if _, err := Read(key); !errors.Is(err, syscall.EOPNOTSUPP) {
+		test.Errorf("Expected EOPNOTSUPP reading a logon key, got %v", err)
+	}
+}
+
+func Test_SetPerm(test *testing.T) {
+	keyring, err := KeyringID(ProcessKeyring, true)
+	if err != nil {
+		test.Skipf("kernel keyring is not available: %v", err)
+	}
+
+	key, err := AddKey(TypeUser, "keyctl-test:perm", []byte("secret"), keyring)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer Unlink(key, keyring)
+
+	if err := SetPerm(key, PosView|PosSetattr|PosLink); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := Read(key); !errors.Is(err, syscall.EACCES) {
+		test.Errorf("Expected EACCES without read permission, got %v", err)
+	}
+}
+
+func Test_Revoke(test *testing.T) {
+	keyring, err := KeyringID(ProcessKeyring, true)
+	if err != nil {
+		test.Skipf("kernel keyring is not available: %v", err)
+	}
+
+	key, err := AddKey(TypeUser, "keyctl-test:revoke", []byte("secret"), keyring)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer Unlink(key, keyring)
+
+	if err := Revoke(key); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := Read(key); !errors.Is(err, syscall.EKEYREVOKED) {
+		test.Errorf("Expected EKEYREVOKED reading a revoked key, got %v", err)
+	}
+}
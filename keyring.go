@@ -0,0 +1,190 @@
+package cryptsetup
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/libc"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// VolumeKeyKeyring enables or disables passing the volume key to dm-crypt via the kernel keyring on activation.
+// It is enabled by default if the kernel supports it, see CRYPT_ACTIVATE_KEYRING_KEY.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_volume_key_keyring
+func (device *Device) VolumeKeyKeyring(enable bool) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	var cEnable int32
+	if enable {
+		cEnable = 1
+	}
+	if res := crypt.VolumeKeyKeyring(device.cryptDevice, cEnable); res < 0 {
+		return &Error{functionName: "crypt_volume_key_keyring", code: int(res)}
+	}
+	return nil
+}
+
+// ActivateByKeyring activates a device using a passphrase stored in a "user" key of the kernel keyring, so the passphrase never passes through Go memory.
+// The key is searched by its description in the thread, process and session keyrings.
+// If deviceName is empty, only the passphrase is checked.
+// Returns the unlocked keyslot on success, or -1 and an error otherwise.
+// C equivalent: crypt_activate_by_keyring
+func (device *Device) ActivateByKeyring(deviceName string, keyDescription string, keyslot int, flags ActivateFlags) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	if err := device.validateActivateFlags(flags); err != nil {
+		return -1, err
+	}
+
+	var cDeviceName *byte
+	if deviceName != "" {
+		cDeviceName = strings.CString(deviceName)
+		defer strings.CFree(cDeviceName)
+	}
+	cKeyDescription := strings.CString(keyDescription)
+	defer strings.CFree(cKeyDescription)
+
+	res := crypt.ActivateByKeyring(device.cryptDevice, cDeviceName, cKeyDescription, int32(keyslot), uint32(flags))
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_activate_by_keyring", code: int(res)}
+	}
+	return int(res), nil
+}
+
+// SetKeyringToLink links the volume key into a keyring on activation, e.g. to hand it over to another process.
+// keyDescription names the linked key and oldKeyDescription the key of the previous volume key during reencryption, which may be empty.
+// keyType is "user" or "logon" and keyringToLink a keyring description as understood by keyctl, e.g. "@s" for the session keyring.
+// An empty keyDescription disables linking.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_keyring_to_link
+func (device *Device) SetKeyringToLink(keyDescription, oldKeyDescription, keyType, keyringToLink string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if err := supported("crypt_set_keyring_to_link"); err != nil {
+		return err
+	}
+
+	var cKeyDescription, cOldKeyDescription, cKeyType, cKeyringToLink *byte
+	if keyDescription != "" {
+		cKeyDescription = strings.CString(keyDescription)
+		defer strings.CFree(cKeyDescription)
+	}
+	if oldKeyDescription != "" {
+		cOldKeyDescription = strings.CString(oldKeyDescription)
+		defer strings.CFree(cOldKeyDescription)
+	}
+	if keyType != "" {
+		cKeyType = strings.CString(keyType)
+		defer strings.CFree(cKeyType)
+	}
+	if keyringToLink != "" {
+		cKeyringToLink = strings.CString(keyringToLink)
+		defer strings.CFree(cKeyringToLink)
+	}
+
+	if res := crypt.SetKeyringToLink(device.cryptDevice, cKeyDescription, cOldKeyDescription, cKeyType, cKeyringToLink); res < 0 {
+		return &Error{functionName: "crypt_set_keyring_to_link", code: int(res)}
+	}
+	return nil
+}
+
+// ReencryptParams are the parameters of a LUKS2 reencryption.
+type ReencryptParams struct {
+	// Mode is one of CRYPT_REENCRYPT_REENCRYPT, CRYPT_REENCRYPT_ENCRYPT and CRYPT_REENCRYPT_DECRYPT.
+	Mode int
+	// Direction is CRYPT_REENCRYPT_FORWARD or CRYPT_REENCRYPT_BACKWARD.
+	Direction int
+	// Resilience is one of "none", "checksum", "journal" and "datashift", or empty for the default.
+	Resilience string
+	// Hash is used by the "checksum" resilience.
+	Hash string
+	// DataShift is the data shift in 512-byte sectors.
+	DataShift      uint64
+	MaxHotzoneSize uint64
+	DeviceSize     uint64
+	// LUKS2 holds the parameters for the new segment, nil for the defaults.
+	LUKS2 *LUKS2
+	// Flags is a combination of CRYPT_REENCRYPT_* flags.
+	Flags uint32
+}
+
+// ReencryptInitByKeyring initializes or resumes a LUKS2 reencryption using a passphrase stored in a "user" key of the kernel keyring.
+// deviceName is the name of the active device for online reencryption, or empty for offline reencryption.
+// libcryptsetup 2.6 reads the passphrase with crypt_safe_alloc but releases it with free(), which aborts the process,
+// so the function is reported as not supported there.
+// Returns the keyslot of the new volume key on success, or -1 and an error otherwise.
+// C equivalent: crypt_reencrypt_init_by_keyring
+func (device *Device) ReencryptInitByKeyring(deviceName string, keyDescription string, keyslotOld, keyslotNew int, cipher, cipherMode string, params ReencryptParams) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	if err := supported("crypt_reencrypt_init_by_keyring"); err != nil {
+		return -1, err
+	}
+	if crypt.Version() == "2.6" {
+		return -1, fmt.Errorf("crypt_reencrypt_init_by_keyring aborts with libcryptsetup 2.6: %w", ErrNotSupported)
+	}
+
+	var cDeviceName, cCipher, cCipherMode *byte
+	if deviceName != "" {
+		cDeviceName = strings.CString(deviceName)
+		defer strings.CFree(cDeviceName)
+	}
+	if cipher != "" {
+		cCipher = strings.CString(cipher)
+		defer strings.CFree(cCipher)
+	}
+	if cipherMode != "" {
+		cCipherMode = strings.CString(cipherMode)
+		defer strings.CFree(cCipherMode)
+	}
+	cKeyDescription := strings.CString(keyDescription)
+	defer strings.CFree(cKeyDescription)
+
+	cParams := (*crypt.ParamsReencrypt)(libc.Malloc(uint64(unsafe.Sizeof(crypt.ParamsReencrypt{}))))
+	defer strings.Free(cParams)
+	*cParams = crypt.ParamsReencrypt{
+		Mode:           int32(params.Mode),
+		Direction:      int32(params.Direction),
+		DataShift:      params.DataShift,
+		MaxHotzoneSize: params.MaxHotzoneSize,
+		DeviceSize:     params.DeviceSize,
+		Flags:          params.Flags,
+	}
+	if params.Resilience != "" {
+		cParams.Resilience = strings.CString(params.Resilience)
+		defer strings.CFree(cParams.Resilience)
+	}
+	if params.Hash != "" {
+		cParams.Hash = strings.CString(params.Hash)
+		defer strings.CFree(cParams.Hash)
+	}
+	if params.LUKS2 != nil {
+		luks2Params, freeLUKS2Params := params.LUKS2.Unmanaged()
+		defer freeLUKS2Params()
+
+		cLUKS2 := (*crypt.ParamsLUKS2)(libc.Malloc(uint64(unsafe.Sizeof(crypt.ParamsLUKS2{}))))
+		defer strings.Free(cLUKS2)
+		*cLUKS2 = *(*crypt.ParamsLUKS2)(luks2Params)
+		cParams.LUKS2 = cLUKS2
+	}
+
+	res := crypt.ReencryptInitByKeyring(device.cryptDevice, cDeviceName, cKeyDescription, int32(keyslotOld), int32(keyslotNew), cCipher, cCipherMode, cParams)
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_reencrypt_init_by_keyring", code: int(res)}
+	}
+	return int(res), nil
+}
@@ -0,0 +1,131 @@
+package cryptsetup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/malt3/purego-cryptsetup/keyctl"
+)
+
+// addKeyringPassphrase stores passphrase as "user" key in the process keyring and removes it on cleanup.
+func addKeyringPassphrase(test *testing.T, description string, passphrase string) {
+	test.Helper()
+
+	keyring, err := keyctl.KeyringID(keyctl.ProcessKeyring, true)
+	if err != nil {
+		test.Skipf("kernel keyring is not available: %v", err)
+	}
+	key, err := keyctl.AddKey(keyctl.TypeUser, description, []byte(passphrase), keyring)
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { keyctl.Unlink(key, keyring) })
+}
+
+func Test_Device_ActivateByKeyring(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	addKeyringPassphrase(test, "cryptsetup-test:passphrase", PassKey)
+	addKeyringPassphrase(test, "cryptsetup-test:wrong", "wrong")
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(3, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	unlocked, err := device.ActivateByKeyring("", "cryptsetup-test:passphrase", CRYPT_ANY_SLOT, 0)
+	testWrapper.AssertNoError(err)
+	if unlocked != keyslot {
+		test.Errorf("Expected keyslot %d, got %d", keyslot, unlocked)
+	}
+
+	_, err = device.ActivateByKeyring("", "cryptsetup-test:wrong", CRYPT_ANY_SLOT, 0)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+	_, err = device.ActivateByKeyring("", "cryptsetup-test:missing", CRYPT_ANY_SLOT, 0)
+	testWrapper.AssertError(err)
+}
+
+func Test_Device_VolumeKeyKeyring(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	testWrapper.AssertNoError(device.VolumeKeyKeyring(false))
+	testWrapper.AssertNoError(device.VolumeKeyKeyring(true))
+}
+
+func Test_Device_SetKeyringToLink(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.SetKeyringToLink("cryptsetup-test:volume-key", "", "logon", "@s")
+	if errors.Is(err, ErrNotSupported) {
+		test.Skip("crypt_set_keyring_to_link is not supported by the loaded libcryptsetup")
+	}
+	testWrapper.AssertNoError(err)
+}
+
+// reencryptChildEnv marks the child process running Test_Device_ReencryptInitByKeyring.
+const reencryptChildEnv = "CRYPTSETUP_TEST_REENCRYPT_CHILD"
+
+func Test_Device_ReencryptInitByKeyring(test *testing.T) {
+	if os.Getenv(reencryptChildEnv) == "" {
+		// Builds not covered by the version check may abort in crypt_reencrypt_init_by_keyring, which would end the whole test run.
+		// The child runs in its own directory, as TestMain creates and removes DevicePath.
+		executable, err := os.Executable()
+		if err != nil {
+			test.Fatal(err)
+		}
+		cmd := exec.Command(executable, "-test.run=^Test_Device_ReencryptInitByKeyring$", "-test.v")
+		cmd.Dir = test.TempDir()
+		cmd.Env = append(os.Environ(), reencryptChildEnv+"=1")
+		out, err := cmd.CombinedOutput()
+		switch {
+		case err != nil && bytes.Contains(out, []byte("free(): invalid pointer")):
+			test.Skip("The loaded libcryptsetup frees the keyring passphrase with the wrong allocator and aborts.")
+		case err != nil:
+			test.Fatalf("%v\n%s", err, out)
+		case bytes.Contains(out, []byte("--- SKIP")):
+			test.Skipf("%s", out)
+		}
+		return
+	}
+
+	testWrapper := TestWrapper{test}
+	addKeyringPassphrase(test, "cryptsetup-test:reencrypt", PassKey)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	params := ReencryptParams{Mode: CRYPT_REENCRYPT_DECRYPT, Direction: CRYPT_REENCRYPT_FORWARD, Resilience: "checksum", Hash: "sha256", Flags: CRYPT_REENCRYPT_INITIALIZE_ONLY}
+	_, err = device.ReencryptInitByKeyring("", "cryptsetup-test:reencrypt", keyslot, CRYPT_ANY_SLOT, "", "", params)
+	if errors.Is(err, ErrNotSupported) {
+		test.Skip("crypt_reencrypt_init_by_keyring is not supported by the loaded libcryptsetup")
+	}
+	testWrapper.AssertNoError(err)
+
+	requirements, err := device.GetRequirementFlags()
+	testWrapper.AssertNoError(err)
+	if !requirements.Has(CRYPT_REQUIREMENT_ONLINE_REENCRYPT) {
+		test.Errorf("Expected reencryption requirement, got %#x", requirements)
+	}
+}
@@ -0,0 +1,84 @@
+package cryptsetup
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/malt3/purego-cryptsetup/keyctl"
+)
+
+// ErrKeyExists is returned by StageKeyringPassphrase if the keyring already holds a key with the description.
+var ErrKeyExists = errors.New("key already exists")
+
+// KeyringPassphrase is a passphrase staged as "user" key in the kernel keyring, e.g. for a luks2-keyring token.
+type KeyringPassphrase struct {
+	Description string
+	Key         keyctl.Serial
+	Keyring     keyctl.Serial
+}
+
+// StageKeyringPassphrase adds the passphrase as "user" key with the description to keyring, e.g. keyctl.SessionKeyring.
+// libcryptsetup only finds keys in the thread, process and session keyrings of the calling process and keyrings linked to them.
+// The key is restricted to its possessor; Revoke it once it is not needed anymore.
+// A "user" key with the description that is already found from keyring is left alone, as adding would update and Revoke would revoke it.
+// Returns the staged key on success, or an error matching ErrKeyExists if there is such a key, or another error otherwise.
+func StageKeyringPassphrase(description string, passphrase []byte, keyring keyctl.Serial) (*KeyringPassphrase, error) {
+	if _, err := keyctl.Search(keyring, keyctl.TypeUser, description); err == nil {
+		return nil, fmt.Errorf("adding key %q: %w", description, ErrKeyExists)
+	}
+
+	key, err := keyctl.AddKey(keyctl.TypeUser, description, passphrase, keyring)
+	if err != nil {
+		return nil, fmt.Errorf("adding key %q: %w", description, err)
+	}
+	staged := &KeyringPassphrase{Description: description, Key: key, Keyring: keyring}
+
+	if err := keyctl.SetPerm(key, keyctl.PosAll); err != nil {
+		staged.Revoke()
+		return nil, fmt.Errorf("restricting key %q: %w", description, err)
+	}
+	return staged, nil
+}
+
+// Revoke revokes the key and unlinks it from its keyring.
+// Returns nil on success, or an error otherwise.
+func (passphrase *KeyringPassphrase) Revoke() error {
+	err := keyctl.Revoke(passphrase.Key)
+	if unlinkErr := keyctl.Unlink(passphrase.Key, passphrase.Keyring); err == nil {
+		err = unlinkErr
+	}
+	if err != nil {
+		return fmt.Errorf("revoking key %q: %w", passphrase.Description, err)
+	}
+	return nil
+}
+
+// EnrollKeyringToken adds a luks2-keyring token that unlocks keyslot with the passphrase stored in the "user" key keyDescription.
+// Use CRYPT_ANY_TOKEN to allocate a new token.
+// Returns the token ID on success, or -1 and an error otherwise.
+func (device *Device) EnrollKeyringToken(token int, keyslot int, keyDescription string) (int, error) {
+	return device.TokenSet(token, &LUKS2KeyringToken{Keyslots: KeyslotList{keyslot}, KeyDescription: keyDescription})
+}
+
+// ActivateByKeyringToken activates a device, or checks the passphrase if deviceName is empty, using a luks2-keyring token.
+// The passphrase is staged in keyring under the key description of the token and revoked once the token has been used.
+// If the key has been staged by someone else, this fails with ErrKeyExists; use ActivateByTokenKeyslot instead.
+// Returns the unlocked keyslot on success, or -1 and an error otherwise.
+// If only the revocation fails, the unlocked keyslot is returned together with the error.
+func (device *Device) ActivateByKeyringToken(deviceName string, token int, passphrase []byte, keyring keyctl.Serial, flags ActivateFlags) (int, error) {
+	params, err := device.TokenLUKS2KeyRingGet(token)
+	if err != nil {
+		return -1, err
+	}
+
+	staged, err := StageKeyringPassphrase(params.KeyDescription, passphrase, keyring)
+	if err != nil {
+		return -1, err
+	}
+
+	keyslot, err := device.ActivateByTokenKeyslot(deviceName, token, nil, flags)
+	if revokeErr := staged.Revoke(); err == nil {
+		err = revokeErr
+	}
+	return keyslot, err
+}
@@ -0,0 +1,96 @@
+package cryptsetup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/malt3/purego-cryptsetup/keyctl"
+)
+
+func Test_Device_ActivateByKeyringToken(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	if _, err := keyctl.KeyringID(keyctl.SessionKeyring, false); err != nil {
+		test.Skipf("session keyring is not available: %v", err)
+	}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(2, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	token, err := device.EnrollKeyringToken(CRYPT_ANY_TOKEN, keyslot, "cryptsetup-test:token")
+	testWrapper.AssertNoError(err)
+	testWrapper.AssertNoError(device.TokenIsAssigned(token, keyslot))
+	if tokenType, _ := device.TokenStatus(token); tokenType != "luks2-keyring" {
+		test.Errorf("Expected luks2-keyring token, got %q", tokenType)
+	}
+
+	unlocked, err := device.ActivateByKeyringToken("", token, []byte(PassKey), keyctl.SessionKeyring, 0)
+	testWrapper.AssertNoError(err)
+	if unlocked != keyslot {
+		test.Errorf("Expected keyslot %d, got %d", keyslot, unlocked)
+	}
+
+	// The staged passphrase has been revoked.
+	if _, err := keyctl.RequestKey(keyctl.TypeUser, "cryptsetup-test:token", 0); err == nil {
+		test.Error("Expected the staged passphrase to be revoked")
+	}
+	_, err = device.ActivateByTokenKeyslot("", token, nil, 0)
+	testWrapper.AssertError(err)
+
+	_, err = device.ActivateByKeyringToken("", token, []byte("wrong"), keyctl.SessionKeyring, 0)
+	testWrapper.AssertErrorCodeEquals(err, -1)
+	if _, err := keyctl.RequestKey(keyctl.TypeUser, "cryptsetup-test:token", 0); err == nil {
+		test.Error("Expected the staged passphrase to be revoked after a failed activation")
+	}
+}
+
+func Test_StageKeyringPassphrase(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	if _, err := keyctl.KeyringID(keyctl.SessionKeyring, false); err != nil {
+		test.Skipf("session keyring is not available: %v", err)
+	}
+
+	staged, err := StageKeyringPassphrase("cryptsetup-test:stage", []byte(PassKey), keyctl.SessionKeyring)
+	testWrapper.AssertNoError(err)
+
+	found, err := keyctl.RequestKey(keyctl.TypeUser, "cryptsetup-test:stage", 0)
+	testWrapper.AssertNoError(err)
+	if found != staged.Key {
+		test.Errorf("Expected key %d, got %d", staged.Key, found)
+	}
+	payload, err := keyctl.Read(staged.Key)
+	testWrapper.AssertNoError(err)
+	if string(payload) != PassKey {
+		test.Errorf("Unexpected payload %q", payload)
+	}
+
+	testWrapper.AssertNoError(staged.Revoke())
+	testWrapper.AssertError(staged.Revoke())
+}
+
+func Test_StageKeyringPassphrase_Fails_If_Key_Exists(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	if _, err := keyctl.KeyringID(keyctl.SessionKeyring, false); err != nil {
+		test.Skipf("session keyring is not available: %v", err)
+	}
+
+	existing, err := keyctl.AddKey(keyctl.TypeUser, "cryptsetup-test:existing", []byte("existing"), keyctl.SessionKeyring)
+	testWrapper.AssertNoError(err)
+	defer keyctl.Unlink(existing, keyctl.SessionKeyring)
+
+	_, err = StageKeyringPassphrase("cryptsetup-test:existing", []byte(PassKey), keyctl.SessionKeyring)
+	if !errors.Is(err, ErrKeyExists) {
+		test.Errorf("Expected ErrKeyExists, got %v", err)
+	}
+
+	payload, err := keyctl.Read(existing)
+	testWrapper.AssertNoError(err)
+	if string(payload) != "existing" {
+		test.Errorf("Expected the existing key to be left alone, got payload %q", payload)
+	}
+}
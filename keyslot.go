@@ -0,0 +1,58 @@
+package cryptsetup
+
+import (
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// KeyslotStatus gets the status of a keyslot.
+// C equivalent: crypt_keyslot_status
+func (device *Device) KeyslotStatus(keyslot int) KeyslotInfo {
+	if device.lock() != nil {
+		return CRYPT_SLOT_INVALID
+	}
+	defer device.mux.Unlock()
+
+	return KeyslotInfo(crypt.KeyslotStatus(device.cryptDevice, int32(keyslot)))
+}
+
+// KeyslotPBKDF gets the PBKDF parameters of an active keyslot.
+// Returns the parameters on success, or an error otherwise.
+// C equivalent: crypt_keyslot_get_pbkdf
+func (device *Device) KeyslotPBKDF(keyslot int) (PbkdfType, error) {
+	if err := device.lock(); err != nil {
+		return PbkdfType{}, err
+	}
+	defer device.mux.Unlock()
+
+	var cPBKDF crypt.PBKDFType
+	if res := crypt.KeyslotGetPBKDF(device.cryptDevice, int32(keyslot), &cPBKDF); res < 0 {
+		return PbkdfType{}, &Error{functionName: "crypt_keyslot_get_pbkdf", code: int(res)}
+	}
+	return PbkdfType{
+		Type:            strings.GoString(cPBKDF.Type),
+		Hash:            strings.GoString(cPBKDF.Hash),
+		TimeMs:          cPBKDF.TimeMs,
+		Iterations:      cPBKDF.Iterations,
+		MaxMemoryKb:     cPBKDF.MaxMemoryKb,
+		ParallelThreads: cPBKDF.ParallelThreads,
+		Flags:           cPBKDF.Flags,
+	}, nil
+}
+
+// KeyslotMax returns the maximal number of keyslots supported by the device type.
+// C equivalent: crypt_keyslot_max
+func KeyslotMax(deviceType string) (int, error) {
+	if err := ensureIntialized(); err != nil {
+		return -1, err
+	}
+
+	cDeviceType := strings.CString(deviceType)
+	defer strings.CFree(cDeviceType)
+
+	res := crypt.KeyslotMax(cDeviceType)
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_keyslot_max", code: int(res)}
+	}
+	return int(res), nil
+}
@@ -0,0 +1,46 @@
+package cryptsetup
+
+import "testing"
+
+func Test_Device_KeyslotStatus(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	if status := device.KeyslotStatus(0); status != CRYPT_SLOT_INACTIVE {
+		test.Errorf("Expected inactive keyslot, got %d", status)
+	}
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+	if status := device.KeyslotStatus(keyslot); status != CRYPT_SLOT_ACTIVE_LAST {
+		test.Errorf("Expected last active keyslot, got %d", status)
+	}
+
+	keyslotPBKDF, err := device.KeyslotPBKDF(keyslot)
+	testWrapper.AssertNoError(err)
+	if keyslotPBKDF.Type != CRYPT_KDF_PBKDF2 || keyslotPBKDF.Hash != "sha256" || keyslotPBKDF.Iterations != 1000 {
+		test.Errorf("Unexpected keyslot PBKDF %+v", keyslotPBKDF)
+	}
+	_, err = device.KeyslotPBKDF(keyslot + 1)
+	testWrapper.AssertError(err)
+}
+
+func Test_KeyslotMax(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	luks1, err := KeyslotMax(CRYPT_LUKS1)
+	testWrapper.AssertNoError(err)
+	luks2, err := KeyslotMax(CRYPT_LUKS2)
+	testWrapper.AssertNoError(err)
+	if luks1 != 8 || luks2 != 32 {
+		test.Errorf("Unexpected keyslot maximum %d and %d", luks1, luks2)
+	}
+
+	_, err = KeyslotMax(CRYPT_PLAIN)
+	testWrapper.AssertError(err)
+}
@@ -0,0 +1,137 @@
+package cryptsetup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/libc"
+)
+
+const (
+	// EnvCryptsetupLibrary overrides the candidates used to load libcryptsetup.
+	// It is typically set to an absolute path.
+	EnvCryptsetupLibrary = "PUREGO_CRYPTSETUP_LIBRARY"
+	// EnvLibcLibrary overrides the candidates used to load libc.
+	// It is typically set to an absolute path.
+	EnvLibcLibrary = "PUREGO_CRYPTSETUP_LIBC"
+)
+
+// DefaultCryptsetupLibraries are the libcryptsetup sonames tried by default, in order.
+var DefaultCryptsetupLibraries = []string{"libcryptsetup.so.12", "libcryptsetup.so"}
+
+// LoadError reports a shared library or a symbol that could not be loaded.
+type LoadError = dlopen.LoadError
+
+// LibraryOptions configure how libcryptsetup and libc are located.
+type LibraryOptions struct {
+	// CryptsetupLibraries are the sonames or paths tried in order to load libcryptsetup.
+	// Defaults to DefaultCryptsetupLibraries.
+	CryptsetupLibraries []string
+	// LibcLibraries are the sonames or paths tried in order to load libc.
+	// Defaults to DefaultLibcLibraries.
+	LibcLibraries []string
+	// SearchPaths are directories searched for sonames before falling back to the
+	// dynamic linker's search path, e.g. for libraries vendored into a distroless image.
+	// Dependencies of the libraries are still resolved by the dynamic linker.
+	SearchPaths []string
+}
+
+// Library is a handle to the loaded libcryptsetup and libc.
+// Shared libraries are loaded once per process, so there is at most one Library.
+type Library struct {
+	cryptsetupPath string
+	libcPath       string
+}
+
+// CryptsetupPath returns the file name or path libcryptsetup was loaded from.
+func (library *Library) CryptsetupPath() string {
+	return library.cryptsetupPath
+}
+
+// LibcPath returns the file name or path libc was loaded from.
+func (library *Library) LibcPath() string {
+	return library.libcPath
+}
+
+var libraryMux = sync.Mutex{}
+
+var library *Library
+
+// Open loads libcryptsetup and libc.
+// The environment variables EnvCryptsetupLibrary and EnvLibcLibrary take
+// precedence over the candidates given in opts.
+// If the libraries are already loaded, opts are ignored and the loaded Library is returned.
+// Returns a *LoadError, possibly joined with others, naming the file and symbol that failed.
+func Open(opts LibraryOptions) (*Library, error) {
+	libraryMux.Lock()
+	defer libraryMux.Unlock()
+
+	if library != nil {
+		return library, nil
+	}
+
+	libcCandidates := opts.LibcLibraries
+	if len(libcCandidates) == 0 {
+		libcCandidates = DefaultLibcLibraries()
+	}
+	libcPath, err := libc.OpenLibc(libraryCandidates(os.Getenv(EnvLibcLibrary), libcCandidates, opts.SearchPaths))
+	if err != nil {
+		return nil, err
+	}
+
+	cryptsetupCandidates := opts.CryptsetupLibraries
+	if len(cryptsetupCandidates) == 0 {
+		cryptsetupCandidates = DefaultCryptsetupLibraries
+	}
+	cryptsetupPath, err := crypt.OpenCryptsetup(libraryCandidates(os.Getenv(EnvCryptsetupLibrary), cryptsetupCandidates, opts.SearchPaths))
+	if err != nil {
+		return nil, err
+	}
+
+	library = &Library{cryptsetupPath: cryptsetupPath, libcPath: libcPath}
+	return library, nil
+}
+
+// DefaultLibcLibraries returns the libc sonames tried by default, in order.
+// These cover glibc and musl for the current architecture.
+func DefaultLibcLibraries() []string {
+	candidates := []string{"libc.so.6"}
+	if arch, ok := muslArch[runtime.GOARCH]; ok {
+		candidates = append(candidates, "libc.musl-"+arch+".so.1", "ld-musl-"+arch+".so.1")
+	}
+	return append(candidates, "libc.so")
+}
+
+// muslArch maps GOARCH to the architecture name used in musl's sonames.
+var muslArch = map[string]string{
+	"386":     "i386",
+	"amd64":   "x86_64",
+	"arm":     "armhf",
+	"arm64":   "aarch64",
+	"ppc64le": "powerpc64le",
+	"riscv64": "riscv64",
+	"s390x":   "s390x",
+}
+
+// libraryCandidates returns the paths to try when loading a library.
+// override, if set, replaces candidates. Sonames are looked up in searchPaths first.
+func libraryCandidates(override string, candidates []string, searchPaths []string) []string {
+	if override != "" {
+		candidates = []string{override}
+	}
+
+	var paths []string
+	for _, candidate := range candidates {
+		if !filepath.IsAbs(candidate) {
+			for _, searchPath := range searchPaths {
+				paths = append(paths, filepath.Join(searchPath, candidate))
+			}
+		}
+		paths = append(paths, candidate)
+	}
+	return paths
+}
@@ -0,0 +1,37 @@
+package cryptsetup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Open_Returns_Loaded_Library(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	library, err := Open(LibraryOptions{})
+	testWrapper.AssertNoError(err)
+	if library.CryptsetupPath() == "" || library.LibcPath() == "" {
+		test.Errorf("Expected library paths to be set, got %q and %q", library.CryptsetupPath(), library.LibcPath())
+	}
+
+	// Libraries are only loaded once, so different options return the same library.
+	again, err := Open(LibraryOptions{CryptsetupLibraries: []string{"/nonexistent/libcryptsetup.so"}})
+	testWrapper.AssertNoError(err)
+	if again != library {
+		test.Error("Expected Open to return the already loaded library")
+	}
+}
+
+func Test_libraryCandidates(test *testing.T) {
+	got := libraryCandidates("", []string{"libcryptsetup.so.12", "/opt/lib/libcryptsetup.so"}, []string{"/vendor/lib"})
+	want := []string{"/vendor/lib/libcryptsetup.so.12", "libcryptsetup.so.12", "/opt/lib/libcryptsetup.so"}
+	if !reflect.DeepEqual(got, want) {
+		test.Errorf("Expected candidates %v, got %v", want, got)
+	}
+
+	got = libraryCandidates("/override/libcryptsetup.so", []string{"libcryptsetup.so.12"}, []string{"/vendor/lib"})
+	want = []string{"/override/libcryptsetup.so"}
+	if !reflect.DeepEqual(got, want) {
+		test.Errorf("Expected candidates %v, got %v", want, got)
+	}
+}
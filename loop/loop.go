@@ -0,0 +1,28 @@
+// Package loop manages loop devices, which expose regular files as block devices.
+// It talks to the kernel's loop driver directly and does not require losetup.
+package loop
+
+// Options configure how a file is bound to a loop device.
+type Options struct {
+	// Offset is the position in the file where the loop device starts, in bytes.
+	Offset uint64
+	// SizeLimit is the maximum size of the loop device in bytes, 0 for the remainder of the file.
+	SizeLimit uint64
+	// BlockSize is the logical block size of the loop device, 0 for the kernel's default of 512.
+	BlockSize uint32
+	// ReadOnly binds the file read-only.
+	ReadOnly bool
+	// AutoClear detaches the loop device once it is closed by its last user.
+	AutoClear bool
+}
+
+// Status describes a loop device.
+type Status struct {
+	// BackingFile is the path of the file bound to the loop device.
+	BackingFile string
+	Offset      uint64
+	SizeLimit   uint64
+	BlockSize   uint32
+	ReadOnly    bool
+	AutoClear   bool
+}
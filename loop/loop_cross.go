@@ -0,0 +1,38 @@
+//go:build !linux
+
+package loop
+
+import "errors"
+
+var errNotSupported = errors.New("loop devices are not supported on this platform")
+
+// Device is an open loop device.
+type Device struct{}
+
+func Attach(path string, opts Options) (*Device, error) {
+	return nil, errNotSupported
+}
+
+func Open(devicePath string) (*Device, error) {
+	return nil, errNotSupported
+}
+
+func (device *Device) Path() string {
+	return ""
+}
+
+func (device *Device) Status() (Status, error) {
+	return Status{}, errNotSupported
+}
+
+func (device *Device) SetCapacity() error {
+	return errNotSupported
+}
+
+func (device *Device) Detach() error {
+	return errNotSupported
+}
+
+func (device *Device) Close() error {
+	return errNotSupported
+}
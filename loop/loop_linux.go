@@ -0,0 +1,220 @@
+//go:build linux
+
+package loop
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// ioctl request numbers from linux/loop.h.
+const (
+	loopSetFD        = 0x4C00
+	loopClrFD        = 0x4C01
+	loopSetStatus64  = 0x4C04
+	loopGetStatus64  = 0x4C05
+	loopSetCapacity  = 0x4C07
+	loopSetBlockSize = 0x4C09
+	loopConfigure    = 0x4C0A
+	loopCtlGetFree   = 0x4C82
+)
+
+// Flags of loopInfo64.flags.
+const (
+	loFlagsReadOnly  = 1
+	loFlagsAutoClear = 4
+)
+
+const loNameSize = 64
+
+// loopInfo64 mirrors struct loop_info64.
+type loopInfo64 struct {
+	device         uint64
+	inode          uint64
+	rdevice        uint64
+	offset         uint64
+	sizeLimit      uint64
+	number         uint32
+	encryptType    uint32
+	encryptKeySize uint32
+	flags          uint32
+	fileName       [loNameSize]byte
+	cryptName      [loNameSize]byte
+	encryptKey     [32]byte
+	init           [2]uint64
+}
+
+// loopConfig mirrors struct loop_config.
+type loopConfig struct {
+	fd        uint32
+	blockSize uint32
+	info      loopInfo64
+	_         [8]uint64
+}
+
+// Device is an open loop device.
+// Closing it releases this process' reference; the binding stays until Detach is called,
+// or until the last user closes it if AutoClear is set.
+type Device struct {
+	file *os.File
+}
+
+// Attach binds the file at path to a free loop device.
+// The returned Device must be closed when done.
+func Attach(path string, opts Options) (*Device, error) {
+	flags := os.O_RDWR
+	if opts.ReadOnly {
+		flags = os.O_RDONLY
+	}
+	backingFile, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer backingFile.Close()
+
+	control, err := os.OpenFile("/dev/loop-control", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer control.Close()
+
+	// Another process may grab the free device before it is bound, so retry a few times.
+	for attempt := 0; attempt < 8; attempt++ {
+		index, err := ioctl(control.Fd(), loopCtlGetFree, 0)
+		if err != nil {
+			return nil, fmt.Errorf("LOOP_CTL_GET_FREE: %w", err)
+		}
+		device, err := os.OpenFile(fmt.Sprintf("/dev/loop%d", index), flags, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = configure(device, backingFile, path, opts)
+		if err == nil {
+			return &Device{file: device}, nil
+		}
+		device.Close()
+		if !errors.Is(err, syscall.EBUSY) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("no free loop device for %s", path)
+}
+
+// Open opens the existing loop device at devicePath, e.g. /dev/loop0.
+func Open(devicePath string) (*Device, error) {
+	file, err := os.OpenFile(devicePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &Device{file: file}, nil
+}
+
+// configure binds backingFile to device with LOOP_CONFIGURE.
+// On kernels older than 5.8, it falls back to LOOP_SET_FD followed by LOOP_SET_STATUS64.
+func configure(device, backingFile *os.File, path string, opts Options) error {
+	config := loopConfig{fd: uint32(backingFile.Fd()), blockSize: opts.BlockSize}
+	config.info.offset = opts.Offset
+	config.info.sizeLimit = opts.SizeLimit
+	if opts.ReadOnly {
+		config.info.flags |= loFlagsReadOnly
+	}
+	if opts.AutoClear {
+		config.info.flags |= loFlagsAutoClear
+	}
+	copy(config.info.fileName[:loNameSize-1], path)
+
+	_, err := ioctl(device.Fd(), loopConfigure, uintptr(unsafe.Pointer(&config)))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTTY) {
+		return fmt.Errorf("LOOP_CONFIGURE %s: %w", device.Name(), err)
+	}
+
+	if _, err := ioctl(device.Fd(), loopSetFD, backingFile.Fd()); err != nil {
+		return fmt.Errorf("LOOP_SET_FD %s: %w", device.Name(), err)
+	}
+	// The read-only flag is derived from the backing file by LOOP_SET_FD and cannot be set.
+	config.info.flags &^= loFlagsReadOnly
+	if _, err := ioctl(device.Fd(), loopSetStatus64, uintptr(unsafe.Pointer(&config.info))); err != nil {
+		_, _ = ioctl(device.Fd(), loopClrFD, 0)
+		return fmt.Errorf("LOOP_SET_STATUS64 %s: %w", device.Name(), err)
+	}
+	if opts.BlockSize != 0 {
+		if _, err := ioctl(device.Fd(), loopSetBlockSize, uintptr(opts.BlockSize)); err != nil {
+			_, _ = ioctl(device.Fd(), loopClrFD, 0)
+			return fmt.Errorf("LOOP_SET_BLOCK_SIZE %s: %w", device.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Path returns the path of the loop device, e.g. /dev/loop0.
+func (device *Device) Path() string {
+	return device.file.Name()
+}
+
+// Status returns the current configuration of the loop device.
+func (device *Device) Status() (Status, error) {
+	var info loopInfo64
+	if _, err := ioctl(device.file.Fd(), loopGetStatus64, uintptr(unsafe.Pointer(&info))); err != nil {
+		return Status{}, fmt.Errorf("LOOP_GET_STATUS64 %s: %w", device.Path(), err)
+	}
+
+	status := Status{
+		Offset:    info.offset,
+		SizeLimit: info.sizeLimit,
+		ReadOnly:  info.flags&loFlagsReadOnly != 0,
+		AutoClear: info.flags&loFlagsAutoClear != 0,
+	}
+	// The kernel truncates lo_file_name, so prefer the full path from sysfs.
+	sysfs := filepath.Join("/sys/block", filepath.Base(device.Path()))
+	if backingFile, err := os.ReadFile(filepath.Join(sysfs, "loop", "backing_file")); err == nil {
+		status.BackingFile = strings.TrimSpace(string(backingFile))
+	} else {
+		status.BackingFile = string(info.fileName[:bytes.IndexByte(append(info.fileName[:], 0), 0)])
+	}
+	if blockSize, err := os.ReadFile(filepath.Join(sysfs, "queue", "logical_block_size")); err == nil {
+		size, _ := strconv.ParseUint(strings.TrimSpace(string(blockSize)), 10, 32)
+		status.BlockSize = uint32(size)
+	}
+	return status, nil
+}
+
+// SetCapacity makes the loop device pick up a changed size of its backing file.
+func (device *Device) SetCapacity() error {
+	if _, err := ioctl(device.file.Fd(), loopSetCapacity, 0); err != nil {
+		return fmt.Errorf("LOOP_SET_CAPACITY %s: %w", device.Path(), err)
+	}
+	return nil
+}
+
+// Detach unbinds the loop device from its backing file and closes it.
+// If the loop device is still in use, the kernel detaches it once its last user closes it.
+func (device *Device) Detach() error {
+	_, err := ioctl(device.file.Fd(), loopClrFD, 0)
+	if closeErr := device.Close(); err == nil {
+		return closeErr
+	}
+	return fmt.Errorf("LOOP_CLR_FD %s: %w", device.Path(), err)
+}
+
+// Close releases the loop device without detaching it.
+func (device *Device) Close() error {
+	return device.file.Close()
+}
+
+func ioctl(fd, request, arg uintptr) (uintptr, error) {
+	res, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, arg)
+	if errno != 0 {
+		return 0, errno
+	}
+	return res, nil
+}
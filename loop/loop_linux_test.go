@@ -0,0 +1,125 @@
+//go:build linux
+
+package loop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+)
+
+func Test_Struct_Sizes(test *testing.T) {
+	if size := unsafe.Sizeof(loopInfo64{}); size != 232 {
+		test.Errorf("loop_info64 should be 232 bytes, but is %d", size)
+	}
+	if size := unsafe.Sizeof(loopConfig{}); size != 304 {
+		test.Errorf("loop_config should be 304 bytes, but is %d", size)
+	}
+}
+
+func backingFile(test *testing.T, size int64) string {
+	test.Helper()
+	if os.Geteuid() != 0 {
+		test.Skip("loop devices require root privileges")
+	}
+	path := filepath.Join(test.TempDir(), "backing.img")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		test.Fatal(err)
+	}
+	if err := os.Truncate(path, size); err != nil {
+		test.Fatal(err)
+	}
+	return path
+}
+
+func isAttached(devicePath string) bool {
+	_, err := os.Stat(filepath.Join("/sys/block", filepath.Base(devicePath), "loop", "backing_file"))
+	return err == nil
+}
+
+func Test_Attach_Status_Detach(test *testing.T) {
+	path := backingFile(test, 8<<20)
+
+	opts := Options{Offset: 1 << 20, SizeLimit: 4 << 20, BlockSize: 4096, ReadOnly: true}
+	device, err := Attach(path, opts)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	status, err := device.Status()
+	if err != nil {
+		test.Fatal(err)
+	}
+	expected := Status{BackingFile: path, Offset: opts.Offset, SizeLimit: opts.SizeLimit, BlockSize: opts.BlockSize, ReadOnly: true}
+	if status != expected {
+		test.Errorf("expected status %+v, got %+v", expected, status)
+	}
+
+	devicePath := device.Path()
+	if err := device.Detach(); err != nil {
+		test.Fatal(err)
+	}
+	if isAttached(devicePath) {
+		test.Errorf("%s should have been detached", devicePath)
+	}
+}
+
+func Test_AutoClear(test *testing.T) {
+	path := backingFile(test, 1<<20)
+
+	device, err := Attach(path, Options{AutoClear: true})
+	if err != nil {
+		test.Fatal(err)
+	}
+	devicePath := device.Path()
+
+	opened, err := Open(devicePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	status, err := opened.Status()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !status.AutoClear || status.ReadOnly {
+		test.Errorf("unexpected status %+v", status)
+	}
+
+	if err := device.Close(); err != nil {
+		test.Fatal(err)
+	}
+	if !isAttached(devicePath) {
+		test.Errorf("%s should still be attached while it is open", devicePath)
+	}
+	if err := opened.Close(); err != nil {
+		test.Fatal(err)
+	}
+	if isAttached(devicePath) {
+		test.Errorf("%s should have been detached by its last close", devicePath)
+	}
+}
+
+func Test_SetCapacity(test *testing.T) {
+	path := backingFile(test, 1<<20)
+
+	device, err := Attach(path, Options{})
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer device.Detach()
+
+	if err := os.Truncate(path, 2<<20); err != nil {
+		test.Fatal(err)
+	}
+	if err := device.SetCapacity(); err != nil {
+		test.Fatal(err)
+	}
+	size, err := os.ReadFile(filepath.Join("/sys/block", filepath.Base(device.Path()), "size"))
+	if err != nil {
+		test.Fatal(err)
+	}
+	if string(size) != "4096\n" {
+		test.Errorf("expected 4096 sectors, got %q", size)
+	}
+}
@@ -168,9 +168,9 @@ func (luks2 LUKS2) Unmanaged() (unsafe.Pointer, func()) {
 		}
 		cIntegrityParams.JournalIntegrityKey = nil
 		if luks2.IntegrityParams.JournalIntegrityKey != "" {
-			cIntegrityParams.JournalIntegrityKey = strings.CString(luks2.IntegrityParams.JournalIntegrityKey)
+			cIntegrityParams.JournalIntegrityKey = strings.CSecretString(luks2.IntegrityParams.JournalIntegrityKey)
 			deallocations = append(deallocations, func() {
-				strings.CFree(cIntegrityParams.JournalIntegrityKey)
+				strings.CSecretFree(cIntegrityParams.JournalIntegrityKey)
 			})
 		}
 		cIntegrityParams.JournalIntegrityKeySize = uint32(luks2.IntegrityParams.JournalIntegrityKeySize)
@@ -184,9 +184,9 @@ func (luks2 LUKS2) Unmanaged() (unsafe.Pointer, func()) {
 		}
 		cIntegrityParams.JournalCryptKey = nil
 		if luks2.IntegrityParams.JournalCryptKey != "" {
-			cIntegrityParams.JournalCryptKey = strings.CString(luks2.IntegrityParams.JournalCryptKey)
+			cIntegrityParams.JournalCryptKey = strings.CSecretString(luks2.IntegrityParams.JournalCryptKey)
 			deallocations = append(deallocations, func() {
-				strings.CFree(cIntegrityParams.JournalCryptKey)
+				strings.CSecretFree(cIntegrityParams.JournalCryptKey)
 			})
 		}
 		cIntegrityParams.JournalCryptKeySize = uint32(luks2.IntegrityParams.JournalCryptKeySize)
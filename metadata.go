@@ -0,0 +1,131 @@
+package cryptsetup
+
+import (
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// SetLabel sets the label and subsystem of a LUKS2 device.
+// Empty strings clear the label or subsystem.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_label
+func (device *Device) SetLabel(label, subsystem string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	var cLabel, cSubsystem *byte
+	if label != "" {
+		cLabel = strings.CString(label)
+		defer strings.CFree(cLabel)
+	}
+	if subsystem != "" {
+		cSubsystem = strings.CString(subsystem)
+		defer strings.CFree(cSubsystem)
+	}
+
+	if res := crypt.SetLabel(device.cryptDevice, cLabel, cSubsystem); res < 0 {
+		return &Error{functionName: "crypt_set_label", code: int(res)}
+	}
+	return nil
+}
+
+// GetLabel gets the label of a LUKS2 device.
+// Returns an empty string if the device has no label.
+// C equivalent: crypt_get_label
+func (device *Device) GetLabel() (string, error) {
+	if err := device.lock(); err != nil {
+		return "", err
+	}
+	defer device.mux.Unlock()
+
+	if err := supported("crypt_get_label"); err != nil {
+		return "", err
+	}
+	return strings.GoString(crypt.GetLabel(device.cryptDevice)), nil
+}
+
+// GetSubsystem gets the subsystem of a LUKS2 device.
+// Returns an empty string if the device has no subsystem.
+// C equivalent: crypt_get_subsystem
+func (device *Device) GetSubsystem() (string, error) {
+	if err := device.lock(); err != nil {
+		return "", err
+	}
+	defer device.mux.Unlock()
+
+	if err := supported("crypt_get_subsystem"); err != nil {
+		return "", err
+	}
+	return strings.GoString(crypt.GetSubsystem(device.cryptDevice)), nil
+}
+
+// SetUUID sets the UUID of a LUKS device, e.g. after cloning it.
+// If uuid is empty, a new random UUID is generated.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_uuid
+func (device *Device) SetUUID(uuid string) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	var cUUID *byte
+	if uuid != "" {
+		cUUID = strings.CString(uuid)
+		defer strings.CFree(cUUID)
+	}
+
+	if res := crypt.SetUUID(device.cryptDevice, cUUID); res < 0 {
+		return &Error{functionName: "crypt_set_uuid", code: int(res)}
+	}
+	return nil
+}
+
+// SetMetadataSize sets the size of the LUKS2 metadata area and of the keyslots area in bytes.
+// A larger metadata area leaves room for more tokens.
+// It must be called before Format; 0 keeps the default of the respective area.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_metadata_size
+func (device *Device) SetMetadataSize(metadataSize, keyslotsSize uint64) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if res := crypt.SetMetadataSize(device.cryptDevice, metadataSize, keyslotsSize); res < 0 {
+		return &Error{functionName: "crypt_set_metadata_size", code: int(res)}
+	}
+	return nil
+}
+
+// GetMetadataSize gets the size of the LUKS2 metadata area and of the keyslots area in bytes.
+// Returns the sizes on success, or an error otherwise.
+// C equivalent: crypt_get_metadata_size
+func (device *Device) GetMetadataSize() (metadataSize, keyslotsSize uint64, err error) {
+	if err := device.lock(); err != nil {
+		return 0, 0, err
+	}
+	defer device.mux.Unlock()
+
+	if res := crypt.GetMetadataSize(device.cryptDevice, &metadataSize, &keyslotsSize); res < 0 {
+		return 0, 0, &Error{functionName: "crypt_get_metadata_size", code: int(res)}
+	}
+	return metadataSize, keyslotsSize, nil
+}
+
+// KeyslotArea gets the location of a keyslot's binary area on the device, in bytes.
+// Returns the offset and length on success, or an error otherwise.
+// C equivalent: crypt_keyslot_area
+func (device *Device) KeyslotArea(keyslot int) (offset, length uint64, err error) {
+	if err := device.lock(); err != nil {
+		return 0, 0, err
+	}
+	defer device.mux.Unlock()
+
+	if res := crypt.KeyslotArea(device.cryptDevice, int32(keyslot), &offset, &length); res < 0 {
+		return 0, 0, &Error{functionName: "crypt_keyslot_area", code: int(res)}
+	}
+	return offset, length, nil
+}
@@ -0,0 +1,97 @@
+package cryptsetup
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Device_SetLabel(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512, Label: "initial", Subsystem: "initialSubsystem"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	testWrapper.AssertNoError(device.SetLabel("relabeled", ""))
+
+	label, err := device.GetLabel()
+	if errors.Is(err, ErrNotSupported) {
+		test.Skip("crypt_get_label is not supported by the loaded libcryptsetup")
+	}
+	testWrapper.AssertNoError(err)
+	if label != "relabeled" {
+		test.Errorf("Expected label relabeled, got %q", label)
+	}
+
+	subsystem, err := device.GetSubsystem()
+	testWrapper.AssertNoError(err)
+	if subsystem != "" {
+		test.Errorf("Expected subsystem to be cleared, got %q", subsystem)
+	}
+}
+
+func Test_Device_SetLabel_Fails_For_LUKS1(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	testWrapper.AssertError(device.SetLabel("label", ""))
+}
+
+func Test_Device_SetUUID(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	uuid := "1f7c6a52-8c4b-4f8e-9f3a-2d6e5b4a3c21"
+	testWrapper.AssertNoError(device.SetUUID(uuid))
+	if device.GetUUID() != uuid {
+		test.Errorf("Expected UUID %s, got %s", uuid, device.GetUUID())
+	}
+
+	testWrapper.AssertNoError(device.SetUUID(""))
+	if device.GetUUID() == uuid || device.GetUUID() == "" {
+		test.Errorf("Expected a new UUID, got %q", device.GetUUID())
+	}
+
+	testWrapper.AssertError(device.SetUUID("not-a-uuid"))
+}
+
+func Test_Device_SetMetadataSize(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	metadataSize, keyslotsSize := uint64(64*1024), uint64(8*1024*1024)
+	testWrapper.AssertNoError(device.SetMetadataSize(metadataSize, keyslotsSize))
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	gotMetadataSize, gotKeyslotsSize, err := device.GetMetadataSize()
+	testWrapper.AssertNoError(err)
+	if gotMetadataSize != metadataSize || gotKeyslotsSize != keyslotsSize {
+		test.Errorf("Expected sizes %d/%d, got %d/%d", metadataSize, keyslotsSize, gotMetadataSize, gotKeyslotsSize)
+	}
+
+	testWrapper.AssertError(device.SetMetadataSize(12345, 0))
+
+	keyslot, err := device.KeyslotAddByVolumeKeyBytes(CRYPT_ANY_SLOT, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+	offset, length, err := device.KeyslotArea(keyslot)
+	testWrapper.AssertNoError(err)
+	if offset < 2*metadataSize || length == 0 {
+		test.Errorf("Unexpected keyslot area at %d with length %d", offset, length)
+	}
+}
@@ -0,0 +1,113 @@
+package cryptsetup
+
+import (
+	"fmt"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// RefreshableFlags are the dm-crypt flags that can be changed on an active device by a refresh.
+const RefreshableFlags ActivateFlags = CRYPT_ACTIVATE_ALLOW_DISCARDS | CRYPT_ACTIVATE_SAME_CPU_CRYPT | CRYPT_ACTIVATE_SUBMIT_FROM_CRYPT_CPUS |
+	CRYPT_ACTIVATE_NO_READ_WORKQUEUE | CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE | CRYPT_ACTIVATE_HIGH_PRIORITY
+
+// RefreshByPassphrase replaces the RefreshableFlags of the active device deviceName with flags without deactivating it.
+// Other flags of the active device are kept, and persistent flags are ignored, so the device ends up with exactly flags.
+// dm-crypt needs the volume key for the new table, so passphrase must unlock keyslot, or any keyslot with CRYPT_ANY_SLOT.
+// If persist is true, flags also replace the RefreshableFlags stored in the LUKS2 header once the refresh succeeded.
+// Returns the unlocked keyslot on success, or -1 and an error otherwise.
+// C equivalent: crypt_activate_by_passphrase with CRYPT_ACTIVATE_REFRESH
+func (device *Device) RefreshByPassphrase(deviceName string, keyslot int, passphrase []byte, flags ActivateFlags, persist bool) (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	cDeviceName, activationFlags, err := device.refreshFlags(deviceName, flags)
+	if err != nil {
+		return -1, err
+	}
+	defer strings.CFree(cDeviceName)
+
+	cPassphrase, freeCPassphrase := cSecret(passphrase)
+	defer freeCPassphrase()
+
+	res := crypt.ActivateByPassphrase(device.cryptDevice, cDeviceName, uint32(keyslot), cPassphrase, uint64(len(passphrase)), activationFlags)
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_activate_by_passphrase", code: int(res)}
+	}
+	if persist {
+		if err := device.persistRefreshableFlags(flags); err != nil {
+			return int(res), err
+		}
+	}
+	return int(res), nil
+}
+
+// RefreshByVolumeKey is like RefreshByPassphrase, but takes the volume key instead of a passphrase.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_volume_key with CRYPT_ACTIVATE_REFRESH
+func (device *Device) RefreshByVolumeKey(deviceName string, volumeKey []byte, flags ActivateFlags, persist bool) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	cDeviceName, activationFlags, err := device.refreshFlags(deviceName, flags)
+	if err != nil {
+		return err
+	}
+	defer strings.CFree(cDeviceName)
+
+	var cVolumeKey *byte
+	if len(volumeKey) > 0 {
+		var freeCVolumeKey func()
+		cVolumeKey, freeCVolumeKey = cSecret(volumeKey)
+		defer freeCVolumeKey()
+	}
+
+	if res := crypt.ActivateByVolumeKey(device.cryptDevice, cDeviceName, cVolumeKey, uint64(len(volumeKey)), activationFlags); res < 0 {
+		return &Error{functionName: "crypt_activate_by_volume_key", code: int(res)}
+	}
+	if persist {
+		return device.persistRefreshableFlags(flags)
+	}
+	return nil
+}
+
+// refreshFlags validates flags and merges them with the flags of the active device.
+// Returns the device name as C string, which the caller must free, and the activation flags for the refresh.
+func (device *Device) refreshFlags(deviceName string, flags ActivateFlags) (*byte, uint32, error) {
+	if unknown := flags &^ RefreshableFlags; unknown != 0 {
+		return nil, 0, fmt.Errorf("flags %#x cannot be refreshed", uint32(unknown))
+	}
+	if err := device.validateActivateFlags(flags); err != nil {
+		return nil, 0, err
+	}
+	if flags.Has(CRYPT_ACTIVATE_HIGH_PRIORITY) && !crypt.VersionAtLeast("2.7") {
+		return nil, 0, fmt.Errorf("CRYPT_ACTIVATE_HIGH_PRIORITY needs libcryptsetup 2.7: %w", ErrNotSupported)
+	}
+
+	cDeviceName := strings.CString(deviceName)
+	var cActive crypt.ActiveDevice
+	if res := crypt.GetActiveDevice(device.cryptDevice, cDeviceName, &cActive); res < 0 {
+		strings.CFree(cDeviceName)
+		return nil, 0, &Error{functionName: "crypt_get_active_device", code: int(res)}
+	}
+
+	activationFlags := ActivateFlags(cActive.Flags)&^RefreshableFlags | flags | CRYPT_ACTIVATE_REFRESH | CRYPT_ACTIVATE_IGNORE_PERSISTENT
+	return cDeviceName, uint32(activationFlags), nil
+}
+
+// persistRefreshableFlags replaces the RefreshableFlags stored in the LUKS2 header with flags.
+func (device *Device) persistRefreshableFlags(flags ActivateFlags) error {
+	var persistent uint32
+	if res := crypt.PersistentFlagsGet(device.cryptDevice, CRYPT_FLAGS_ACTIVATION, &persistent); res < 0 {
+		return &Error{functionName: "crypt_persistent_flags_get", code: int(res)}
+	}
+	persistent = uint32(ActivateFlags(persistent)&^RefreshableFlags | flags)
+	if res := crypt.PersistentFlagsSet(device.cryptDevice, CRYPT_FLAGS_ACTIVATION, persistent); res < 0 {
+		return &Error{functionName: "crypt_persistent_flags_set", code: int(res)}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cryptsetup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+)
+
+func Test_Device_RefreshByPassphrase_Fails_For_Inactive_Device(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	pbkdf := &PbkdfType{Type: CRYPT_KDF_PBKDF2, Hash: "sha256", Iterations: 1000, Flags: CRYPT_PBKDF_NO_BENCHMARK}
+	err = device.Format(LUKS2{PBKDFType: pbkdf}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+	_, err = device.KeyslotAddByVolumeKeyBytes(0, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	_, err = device.RefreshByPassphrase(DeviceName, 0, []byte(PassKey), CRYPT_ACTIVATE_NO_READ_WORKQUEUE, true)
+	testWrapper.AssertError(err)
+	err = device.RefreshByVolumeKey(DeviceName, nil, CRYPT_ACTIVATE_NO_WRITE_WORKQUEUE, false)
+	testWrapper.AssertError(err)
+
+	// Nothing is persisted if the refresh fails.
+	flags, err := device.GetPersistentFlags()
+	testWrapper.AssertNoError(err)
+	if flags != 0 {
+		test.Errorf("Expected no persistent flags, got %#x", flags)
+	}
+}
+
+func Test_Device_RefreshByPassphrase_Rejects_Flags(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	_, err = device.RefreshByPassphrase(DeviceName, CRYPT_ANY_SLOT, []byte(PassKey), CRYPT_ACTIVATE_READONLY, false)
+	testWrapper.AssertError(err)
+
+	_, err = device.RefreshByPassphrase(DeviceName, CRYPT_ANY_SLOT, []byte(PassKey), CRYPT_ACTIVATE_HIGH_PRIORITY, false)
+	if supported := crypt.VersionAtLeast("2.7"); supported == errors.Is(err, ErrNotSupported) {
+		test.Errorf("Unexpected error %v for libcryptsetup %s", err, crypt.Version())
+	}
+}
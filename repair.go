@@ -0,0 +1,336 @@
+package cryptsetup
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// ErrHeaderNotRepairable is returned by RepairHeader if no valid header copy is left to repair from.
+var ErrHeaderNotRepairable = errors.New("no valid header copy to repair from")
+
+// Repair repairs a damaged LUKS header or keyslot area of a device that has not been loaded.
+// Note that Load already restores a damaged LUKS2 header copy from the other one if it is valid.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_repair
+func (device *Device) Repair(deviceType DeviceType) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	return device.repair(deviceType)
+}
+
+func (device *Device) repair(deviceType DeviceType) error {
+	var cDeviceType *byte
+	var cParams unsafe.Pointer
+	if deviceType != nil {
+		cDeviceType = strings.CString(deviceType.Name())
+		defer strings.CFree(cDeviceType)
+
+		var freeCParams func()
+		cParams, freeCParams = deviceType.Unmanaged()
+		defer freeCParams()
+	}
+
+	if res := crypt.Repair(device.cryptDevice, cDeviceType, cParams); res < 0 {
+		return &Error{functionName: "crypt_repair", code: int(res)}
+	}
+	return nil
+}
+
+// RepairHeader diagnoses the header of a device that has not been loaded and repairs it if needed.
+// A damaged LUKS2 header copy is restored from the other, valid copy; if both copies are damaged, ErrHeaderNotRepairable is returned without writing anything.
+// The header is diagnosed again after the repair, and an error is returned if it is still damaged.
+// Returns the diagnosis before the repair, whose String method describes what was changed.
+func (device *Device) RepairHeader(deviceType DeviceType) (HeaderDiagnosis, error) {
+	if err := device.lock(); err != nil {
+		return HeaderDiagnosis{}, err
+	}
+	defer device.mux.Unlock()
+
+	path := device.metadataDevicePath()
+	diagnosis, err := DiagnoseHeader(path)
+	if err != nil {
+		return HeaderDiagnosis{}, err
+	}
+	if diagnosis.Type == CRYPT_LUKS2 {
+		if !diagnosis.Damaged() {
+			return diagnosis, nil
+		}
+		if !diagnosis.Primary.Valid() && !diagnosis.Secondary.Valid() {
+			return diagnosis, ErrHeaderNotRepairable
+		}
+	}
+
+	if err := device.repair(deviceType); err != nil {
+		return diagnosis, err
+	}
+
+	repaired, err := DiagnoseHeader(path)
+	if err != nil {
+		return diagnosis, err
+	}
+	if repaired.Damaged() {
+		return diagnosis, fmt.Errorf("header is still damaged after repair: %s", repaired)
+	}
+	return diagnosis, nil
+}
+
+// DiagnoseHeader diagnoses the header of the device that has not been loaded.
+// Returns the diagnosis on success, or an error if the header cannot be read.
+func (device *Device) DiagnoseHeader() (HeaderDiagnosis, error) {
+	if err := device.lock(); err != nil {
+		return HeaderDiagnosis{}, err
+	}
+	defer device.mux.Unlock()
+
+	return DiagnoseHeader(device.metadataDevicePath())
+}
+
+// metadataDevicePath returns the path of the device holding the header.
+func (device *Device) metadataDevicePath() string {
+	if path := crypt.GetMetadataDeviceName(device.cryptDevice); path != nil {
+		return strings.GoString(path)
+	}
+	return strings.GoString(crypt.GetDeviceName(device.cryptDevice))
+}
+
+// HeaderDiagnosis describes the state of the on-disk header copies of a LUKS device.
+type HeaderDiagnosis struct {
+	// Type is CRYPT_LUKS1, CRYPT_LUKS2 or empty if no LUKS header was found.
+	Type string
+	// Primary is the header at the start of the device.
+	Primary HeaderCopy
+	// Secondary is the LUKS2 header copy, which LUKS1 does not have.
+	Secondary HeaderCopy
+}
+
+// HeaderCopy describes one on-disk copy of a LUKS header.
+type HeaderCopy struct {
+	Offset uint64
+	// Found is true if the header magic was found at Offset.
+	Found bool
+	// Size is the size of the LUKS2 binary header and JSON area in bytes.
+	Size  uint64
+	SeqID uint64
+	UUID  string
+	Label string
+
+	// ChecksumValid is true if the checksum of the LUKS2 header matches.
+	ChecksumValid bool
+	// JSONValid is true if the LUKS2 JSON area can be parsed.
+	JSONValid bool
+}
+
+// Valid reports whether the header copy can be used.
+func (header HeaderCopy) Valid() bool {
+	return header.Found && header.ChecksumValid && header.JSONValid
+}
+
+func (header HeaderCopy) String() string {
+	switch {
+	case !header.Found:
+		return fmt.Sprintf("missing at offset %d", header.Offset)
+	case !header.ChecksumValid:
+		return fmt.Sprintf("checksum mismatch at offset %d", header.Offset)
+	case !header.JSONValid:
+		return fmt.Sprintf("invalid JSON area at offset %d", header.Offset)
+	default:
+		return fmt.Sprintf("valid at offset %d with seqid %d", header.Offset, header.SeqID)
+	}
+}
+
+// Damaged reports whether a LUKS2 header copy is damaged or outdated and would be rewritten by a repair.
+func (diagnosis HeaderDiagnosis) Damaged() bool {
+	if diagnosis.Type != CRYPT_LUKS2 {
+		return false
+	}
+	return !diagnosis.Primary.Valid() || !diagnosis.Secondary.Valid() || diagnosis.Primary.SeqID != diagnosis.Secondary.SeqID
+}
+
+// String describes the state of the header and what a repair would change.
+func (diagnosis HeaderDiagnosis) String() string {
+	switch diagnosis.Type {
+	case "":
+		return "no LUKS header found"
+	case CRYPT_LUKS1:
+		return "LUKS1 header " + diagnosis.Primary.String()
+	}
+
+	primary, secondary := diagnosis.Primary, diagnosis.Secondary
+	state := fmt.Sprintf("primary header %s, secondary header %s", primary, secondary)
+	switch {
+	case !primary.Valid() && !secondary.Valid():
+		return state + "; no valid copy to repair from"
+	case !primary.Valid(), primary.Valid() && secondary.Valid() && secondary.SeqID > primary.SeqID:
+		return state + "; primary header would be restored from secondary header"
+	case !secondary.Valid(), secondary.SeqID < primary.SeqID:
+		return state + "; secondary header would be restored from primary header"
+	default:
+		return state
+	}
+}
+
+const (
+	luks2BinaryHeaderSize = 4096
+	luks2ChecksumOffset   = 448
+	luks2ChecksumSize     = 64
+)
+
+var (
+	luksMagic           = []byte{'L', 'U', 'K', 'S', 0xba, 0xbe}
+	luks2SecondaryMagic = []byte{'S', 'K', 'U', 'L', 0xba, 0xbe}
+
+	// luks2HeaderSizes are the possible sizes of a LUKS2 header copy, which is also the offset of the secondary copy.
+	luks2HeaderSizes = []uint64{16 << 10, 32 << 10, 64 << 10, 128 << 10, 256 << 10, 512 << 10, 1 << 20, 2 << 20, 4 << 20}
+)
+
+// luks2BinaryHeader is the on-disk binary header of a LUKS2 header copy, in big-endian byte order.
+type luks2BinaryHeader struct {
+	Magic        [6]byte
+	Version      uint16
+	HeaderSize   uint64
+	SeqID        uint64
+	Label        [48]byte
+	ChecksumAlg  [32]byte
+	Salt         [64]byte
+	UUID         [40]byte
+	Subsystem    [48]byte
+	HeaderOffset uint64
+	_            [184]byte
+	Checksum     [luks2ChecksumSize]byte
+}
+
+// DiagnoseHeader diagnoses the LUKS header copies on the device or header file at path without modifying it.
+// It must be used before the device is loaded, as Load restores a damaged LUKS2 header copy.
+// Returns the diagnosis on success, or an error if the device cannot be read.
+func DiagnoseHeader(path string) (HeaderDiagnosis, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return HeaderDiagnosis{}, err
+	}
+	defer file.Close()
+
+	primary, version, err := readHeaderCopy(file, 0, luksMagic)
+	if err != nil {
+		return HeaderDiagnosis{}, err
+	}
+	if primary.Found && version == 1 {
+		primary.ChecksumValid, primary.JSONValid = true, true
+		return HeaderDiagnosis{Type: CRYPT_LUKS1, Primary: primary}, nil
+	}
+
+	// The secondary header follows the primary one, so its offset is unknown if the primary one is damaged.
+	var secondary HeaderCopy
+	offsets := luks2HeaderSizes
+	if primary.Valid() {
+		offsets = []uint64{primary.Size}
+	}
+	for _, offset := range offsets {
+		secondary, version, err = readHeaderCopy(file, offset, luks2SecondaryMagic)
+		if err != nil {
+			return HeaderDiagnosis{}, err
+		}
+		if secondary.Found {
+			break
+		}
+	}
+	if primary.Valid() && !secondary.Found {
+		secondary.Offset = primary.Size
+	}
+
+	if !primary.Found && !secondary.Found {
+		return HeaderDiagnosis{}, nil
+	}
+	return HeaderDiagnosis{Type: CRYPT_LUKS2, Primary: primary, Secondary: secondary}, nil
+}
+
+// readHeaderCopy reads a LUKS header copy at offset and returns it with its version.
+func readHeaderCopy(file *os.File, offset uint64, magic []byte) (HeaderCopy, uint16, error) {
+	header := HeaderCopy{Offset: offset}
+
+	binaryHeader := make([]byte, luks2BinaryHeaderSize)
+	if _, err := file.ReadAt(binaryHeader, int64(offset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return header, 0, nil
+		}
+		return header, 0, err
+	}
+	var fields luks2BinaryHeader
+	if err := binary.Read(bytes.NewReader(binaryHeader), binary.BigEndian, &fields); err != nil {
+		return header, 0, err
+	}
+	if !bytes.Equal(fields.Magic[:], magic) {
+		return header, 0, nil
+	}
+
+	header.Found = true
+	if fields.Version != 2 {
+		return header, fields.Version, nil
+	}
+	header.Size = fields.HeaderSize
+	header.SeqID = fields.SeqID
+	header.UUID = cString(fields.UUID[:])
+	header.Label = cString(fields.Label[:])
+
+	validSize := false
+	for _, size := range luks2HeaderSizes {
+		validSize = validSize || size == fields.HeaderSize
+	}
+	if !validSize || fields.HeaderOffset != offset {
+		return header, fields.Version, nil
+	}
+
+	area := make([]byte, fields.HeaderSize)
+	if _, err := file.ReadAt(area, int64(offset)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return header, fields.Version, nil
+		}
+		return header, fields.Version, err
+	}
+
+	var checksum hash.Hash
+	switch cString(fields.ChecksumAlg[:]) {
+	case "sha1":
+		checksum = sha1.New()
+	case "sha256":
+		checksum = sha256.New()
+	case "sha512":
+		checksum = sha512.New()
+	default:
+		return header, fields.Version, nil
+	}
+	copy(area[luks2ChecksumOffset:luks2ChecksumOffset+luks2ChecksumSize], make([]byte, luks2ChecksumSize))
+	checksum.Write(area)
+	header.ChecksumValid = bytes.Equal(checksum.Sum(nil), fields.Checksum[:checksum.Size()])
+
+	jsonArea := area[luks2BinaryHeaderSize:]
+	if end := bytes.IndexByte(jsonArea, 0); end >= 0 {
+		jsonArea = jsonArea[:end]
+	}
+	header.JSONValid = json.Valid(jsonArea)
+
+	return header, fields.Version, nil
+}
+
+// cString returns the NUL-terminated string at the start of b.
+func cString(b []byte) string {
+	if end := bytes.IndexByte(b, 0); end >= 0 {
+		b = b[:end]
+	}
+	return string(b)
+}
@@ -0,0 +1,117 @@
+package cryptsetup
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// corruptDevice overwrites part of the device at offset.
+func corruptDevice(test *testing.T, offset int64) {
+	test.Helper()
+
+	file, err := os.OpenFile(DevicePath, os.O_RDWR, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteAt([]byte("corrupted"), offset); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func formatLUKS2(test *testing.T) {
+	test.Helper()
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+}
+
+func Test_DiagnoseHeader(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	formatLUKS2(test)
+
+	diagnosis, err := DiagnoseHeader(DevicePath)
+	testWrapper.AssertNoError(err)
+	if diagnosis.Type != CRYPT_LUKS2 || diagnosis.Damaged() {
+		test.Errorf("Expected healthy LUKS2 header, got %s", diagnosis)
+	}
+	if !diagnosis.Primary.Valid() || diagnosis.Primary.Offset != 0 || diagnosis.Secondary.Offset != diagnosis.Primary.Size {
+		test.Errorf("Unexpected header copies %+v", diagnosis)
+	}
+
+	corruptDevice(test, int64(diagnosis.Secondary.Offset)+luks2BinaryHeaderSize)
+	damaged, err := DiagnoseHeader(DevicePath)
+	testWrapper.AssertNoError(err)
+	if !damaged.Damaged() || !damaged.Primary.Valid() || damaged.Secondary.ChecksumValid {
+		test.Errorf("Expected damaged secondary header, got %s", damaged)
+	}
+}
+
+func Test_DiagnoseHeader_LUKS1(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	diagnosis, err := DiagnoseHeader(DevicePath)
+	testWrapper.AssertNoError(err)
+	if diagnosis.Type != CRYPT_LUKS1 || diagnosis.Damaged() {
+		test.Errorf("Expected healthy LUKS1 header, got %s", diagnosis)
+	}
+}
+
+func Test_Device_RepairHeader(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	formatLUKS2(test)
+	corruptDevice(test, luks2BinaryHeaderSize)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	diagnosis, err := device.DiagnoseHeader()
+	testWrapper.AssertNoError(err)
+	if diagnosis.Primary.Valid() || !diagnosis.Secondary.Valid() {
+		test.Errorf("Expected damaged primary header, got %s", diagnosis)
+	}
+
+	repaired, err := device.RepairHeader(LUKS2{})
+	testWrapper.AssertNoError(err)
+	if repaired != diagnosis {
+		test.Errorf("Expected diagnosis before repair %s, got %s", diagnosis, repaired)
+	}
+
+	diagnosis, err = DiagnoseHeader(DevicePath)
+	testWrapper.AssertNoError(err)
+	if diagnosis.Damaged() {
+		test.Errorf("Expected repaired header, got %s", diagnosis)
+	}
+	testWrapper.AssertNoError(device.Load(nil))
+}
+
+func Test_Device_RepairHeader_Fails_Without_Valid_Copy(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	formatLUKS2(test)
+
+	diagnosis, err := DiagnoseHeader(DevicePath)
+	testWrapper.AssertNoError(err)
+	corruptDevice(test, luks2BinaryHeaderSize)
+	corruptDevice(test, int64(diagnosis.Secondary.Offset)+luks2BinaryHeaderSize)
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	_, err = device.RepairHeader(LUKS2{})
+	if !errors.Is(err, ErrHeaderNotRepairable) {
+		test.Errorf("Expected ErrHeaderNotRepairable, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package cryptsetup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	gostrings "strings"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+)
+
+// SetRNGType sets the random number generator used by libcryptsetup for volume keys and salts,
+// CRYPT_RNG_URANDOM or CRYPT_RNG_RANDOM.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_set_rng_type
+func (device *Device) SetRNGType(rngType int) error {
+	if rngType != CRYPT_RNG_URANDOM && rngType != CRYPT_RNG_RANDOM {
+		return fmt.Errorf("unknown RNG type %d", rngType)
+	}
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	crypt.SetRNGType(device.cryptDevice, int32(rngType))
+	return nil
+}
+
+// GetRNGType gets the random number generator used by libcryptsetup, CRYPT_RNG_URANDOM or CRYPT_RNG_RANDOM.
+// Returns the RNG type on success, or an error otherwise.
+// C equivalent: crypt_get_rng_type
+func (device *Device) GetRNGType() (int, error) {
+	if err := device.lock(); err != nil {
+		return -1, err
+	}
+	defer device.mux.Unlock()
+
+	res := crypt.GetRNGType(device.cryptDevice)
+	if res < 0 {
+		return -1, &Error{functionName: "crypt_get_rng_type", code: int(res)}
+	}
+	return int(res), nil
+}
+
+// ErrInvalidVolumeKeySize is matched by errors returned for a volume key size the cipher does not support.
+var ErrInvalidVolumeKeySize = errors.New("invalid volume key size")
+
+// readVolumeKey reads a volume key of genericParams.VolumeKeySize bytes from genericParams.VolumeKeyReader.
+// The caller should WipeSecret the returned volume key when done.
+func readVolumeKey(deviceType DeviceType, genericParams GenericParams) ([]byte, error) {
+	if err := validateVolumeKeySize(deviceType, genericParams); err != nil {
+		return nil, err
+	}
+	volumeKey := make([]byte, genericParams.VolumeKeySize)
+	if _, err := io.ReadFull(genericParams.VolumeKeyReader, volumeKey); err != nil {
+		WipeSecret(volumeKey)
+		return nil, fmt.Errorf("reading volume key: %w", err)
+	}
+	return volumeKey, nil
+}
+
+// validateVolumeKeySize checks the volume key size against the key sizes of well-known ciphers and modes.
+// Sizes for other ciphers and modes, and for LUKS2 with integrity protection, are left to libcryptsetup.
+func validateVolumeKeySize(deviceType DeviceType, genericParams GenericParams) error {
+	size := genericParams.VolumeKeySize
+	if size <= 0 {
+		return fmt.Errorf("volume key size %d: %w", size, ErrInvalidVolumeKeySize)
+	}
+	if luks2, ok := deviceType.(LUKS2); ok && luks2.Integrity != "" {
+		return nil
+	}
+
+	switch genericParams.Cipher {
+	case "aes", "serpent", "twofish", "camellia":
+	default:
+		return nil
+	}
+	// The lmk and tcw IV generators take additional key material.
+	chainMode, ivMode, _ := gostrings.Cut(genericParams.CipherMode, "-")
+	if ivMode != "" && ivMode != "plain" && ivMode != "plain64" && ivMode != "plain64be" && ivMode != "benbi" &&
+		ivMode != "null" && ivMode != "eboiv" && !gostrings.HasPrefix(ivMode, "essiv:") {
+		return nil
+	}
+
+	var sizes []int
+	switch chainMode {
+	case "ecb", "cbc", "ctr":
+		sizes = []int{16, 24, 32}
+	case "xts":
+		// XTS splits the key into two cipher keys of the same size.
+		sizes = []int{32, 48, 64}
+	case "lrw":
+		// LRW appends a 16 byte tweak key to the cipher key.
+		sizes = []int{32, 40, 48}
+	default:
+		return nil
+	}
+
+	for _, valid := range sizes {
+		if size == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("volume key size %d for %s-%s, expected one of %v: %w", size, genericParams.Cipher, genericParams.CipherMode, sizes, ErrInvalidVolumeKeySize)
+}
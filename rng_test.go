@@ -0,0 +1,109 @@
+package cryptsetup
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func Test_Device_RNGType(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	testWrapper.AssertNoError(device.SetRNGType(CRYPT_RNG_RANDOM))
+	rngType, err := device.GetRNGType()
+	testWrapper.AssertNoError(err)
+	if rngType != CRYPT_RNG_RANDOM {
+		test.Errorf("Expected CRYPT_RNG_RANDOM, got %d", rngType)
+	}
+
+	testWrapper.AssertNoError(device.SetRNGType(CRYPT_RNG_URANDOM))
+	rngType, err = device.GetRNGType()
+	testWrapper.AssertNoError(err)
+	if rngType != CRYPT_RNG_URANDOM {
+		test.Errorf("Expected CRYPT_RNG_URANDOM, got %d", rngType)
+	}
+
+	testWrapper.AssertError(device.SetRNGType(2))
+}
+
+func Test_Device_Format_VolumeKeyReader(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	source := bytes.Repeat([]byte{0x5a}, 64)
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{
+		Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8, VolumeKeyReader: bytes.NewReader(source),
+	})
+	testWrapper.AssertNoError(err)
+	_, err = device.KeyslotAddByVolumeKeyBytes(0, nil, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+
+	volumeKey, _, err := device.VolumeKeyGetBytes(0, []byte(PassKey))
+	testWrapper.AssertNoError(err)
+	if !bytes.Equal(volumeKey, source) {
+		test.Error("Expected the volume key to be read from VolumeKeyReader")
+	}
+}
+
+func Test_Device_Format_VolumeKeyReader_Fails(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	for _, genericParams := range []GenericParams{
+		{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 40},
+		{Cipher: "aes", CipherMode: "cbc-essiv:sha256", VolumeKeySize: 64},
+		{Cipher: "aes", CipherMode: "xts-plain64"},
+	} {
+		genericParams.VolumeKeyReader = bytes.NewReader(make([]byte, 64))
+		err = device.Format(LUKS1{Hash: "sha256"}, genericParams)
+		if !errors.Is(err, ErrInvalidVolumeKeySize) {
+			test.Errorf("Expected invalid volume key size for %+v, got %v", genericParams, err)
+		}
+	}
+
+	// A short read fails instead of formatting with a partial key.
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{
+		Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 64, VolumeKeyReader: bytes.NewReader(make([]byte, 32)),
+	})
+	testWrapper.AssertError(err)
+	if device.Type() != "" {
+		test.Errorf("Expected the device to stay unformatted, got %s", device.Type())
+	}
+}
+
+func Test_validateVolumeKeySize(test *testing.T) {
+	for _, tc := range []struct {
+		deviceType    DeviceType
+		genericParams GenericParams
+		valid         bool
+	}{
+		{LUKS2{}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 32}, true},
+		{LUKS2{}, GenericParams{Cipher: "aes", CipherMode: "cbc-essiv:sha256", VolumeKeySize: 24}, true},
+		{LUKS2{}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 48}, true},
+		{LUKS2{}, GenericParams{Cipher: "serpent", CipherMode: "lrw-benbi", VolumeKeySize: 40}, true},
+		{LUKS2{}, GenericParams{Cipher: "serpent", CipherMode: "lrw-benbi", VolumeKeySize: 48}, true},
+		{LUKS2{}, GenericParams{Cipher: "serpent", CipherMode: "lrw-benbi", VolumeKeySize: 64}, false},
+		{LUKS2{}, GenericParams{Cipher: "twofish", CipherMode: "xts-plain64", VolumeKeySize: 16}, false},
+		{LUKS2{}, GenericParams{Cipher: "aes", CipherMode: "ecb", VolumeKeySize: 64}, false},
+		{Plain{}, GenericParams{Cipher: "aes", CipherMode: "cbc-tcw", VolumeKeySize: 64}, true},
+		{Plain{}, GenericParams{Cipher: "aes", CipherMode: "gcm-random", VolumeKeySize: 36}, true},
+		{LUKS2{Integrity: "hmac(sha256)"}, GenericParams{Cipher: "aes", CipherMode: "xts-random", VolumeKeySize: 96}, true},
+		{Plain{}, GenericParams{Cipher: "xchacha12,aes", CipherMode: "adiantum-plain64", VolumeKeySize: 32}, true},
+		{Plain{}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: -1}, false},
+	} {
+		err := validateVolumeKeySize(tc.deviceType, tc.genericParams)
+		if tc.valid != (err == nil) {
+			test.Errorf("Unexpected result %v for %+v", err, tc.genericParams)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package cryptsetup
+
+import (
+	"runtime"
+
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// WipeSecret overwrites a secret, such as a passphrase or a volume key, with zeroes.
+// Use it to clear secrets returned by this package once they are no longer needed.
+func WipeSecret(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+	runtime.KeepAlive(secret)
+}
+
+// cSecret copies a secret to C memory for the duration of a libcryptsetup call.
+// The returned function zeroes and frees the C copy.
+func cSecret(secret []byte) (*byte, func()) {
+	cSecret := strings.CSecret(secret)
+	return cSecret, func() {
+		strings.CSecretFree(cSecret)
+	}
+}
@@ -0,0 +1,484 @@
+package cryptsetup
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Token is a typed LUKS2 token definition.
+type Token interface {
+	// Type returns the token type as stored in the "type" field.
+	Type() string
+	// AssignedKeyslots returns the keyslots assigned to the token.
+	AssignedKeyslots() []int
+	// Validate returns an error if the token definition is malformed.
+	Validate() error
+}
+
+// KeyslotList is the list of keyslots assigned to a token.
+// It is encoded as a list of strings, as required by the LUKS2 header format.
+type KeyslotList []int
+
+// MarshalJSON encodes the keyslots as a list of strings.
+func (k KeyslotList) MarshalJSON() ([]byte, error) {
+	keyslots := make([]string, len(k))
+	for i, keyslot := range k {
+		keyslots[i] = strconv.Itoa(keyslot)
+	}
+	return json.Marshal(keyslots)
+}
+
+// UnmarshalJSON decodes a list of strings into keyslots.
+func (k *KeyslotList) UnmarshalJSON(data []byte) error {
+	var keyslots []string
+	if err := json.Unmarshal(data, &keyslots); err != nil {
+		return err
+	}
+	*k = make(KeyslotList, len(keyslots))
+	for i, keyslot := range keyslots {
+		n, err := strconv.Atoi(keyslot)
+		if err != nil {
+			return fmt.Errorf("invalid keyslot %q: %w", keyslot, err)
+		}
+		(*k)[i] = n
+	}
+	return nil
+}
+
+func (k KeyslotList) validate() error {
+	for _, keyslot := range k {
+		if keyslot < 0 {
+			return fmt.Errorf("invalid keyslot %d", keyslot)
+		}
+	}
+	return nil
+}
+
+// UnknownTokenFields keeps the fields of a token JSON definition that a typed token does not declare,
+// e.g. fields added by a newer systemd. MarshalToken writes them back unchanged.
+// Token types passed to DefineTokenType embed it to keep such fields as well.
+type UnknownTokenFields struct {
+	Unknown map[string]json.RawMessage `json:"-"`
+}
+
+func (f *UnknownTokenFields) unknownFields() *map[string]json.RawMessage { return &f.Unknown }
+
+// tokenWithUnknownFields is implemented by tokens embedding UnknownTokenFields.
+type tokenWithUnknownFields interface {
+	unknownFields() *map[string]json.RawMessage
+}
+
+// SystemdTPM2Token is a token enrolled by systemd-cryptenroll --tpm2-device.
+type SystemdTPM2Token struct {
+	Keyslots      KeyslotList `json:"keyslots"`
+	Blob          []byte      `json:"tpm2-blob"`
+	PCRs          []int       `json:"tpm2-pcrs"`
+	PCRBank       string      `json:"tpm2-pcr-bank,omitempty"`
+	PrimaryAlg    string      `json:"tpm2-primary-alg,omitempty"`
+	PolicyHash    string      `json:"tpm2-policy-hash"`
+	PIN           bool        `json:"tpm2-pin,omitempty"`
+	PCRLock       bool        `json:"tpm2_pcrlock,omitempty"`
+	PublicKeyPCRs []int       `json:"tpm2_pubkey_pcrs,omitempty"`
+	PublicKey     []byte      `json:"tpm2_pubkey,omitempty"`
+	Salt          []byte      `json:"tpm2_salt,omitempty"`
+	SRK           []byte      `json:"tpm2_srk,omitempty"`
+
+	UnknownTokenFields
+}
+
+// Type returns "systemd-tpm2".
+func (t *SystemdTPM2Token) Type() string { return "systemd-tpm2" }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *SystemdTPM2Token) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate returns an error if the token definition is malformed.
+func (t *SystemdTPM2Token) Validate() error {
+	if err := t.Keyslots.validate(); err != nil {
+		return err
+	}
+	if len(t.Blob) == 0 {
+		return errors.New("systemd-tpm2: missing tpm2-blob")
+	}
+	for _, pcr := range append(append([]int{}, t.PCRs...), t.PublicKeyPCRs...) {
+		if pcr < 0 || pcr > 23 {
+			return fmt.Errorf("systemd-tpm2: invalid PCR %d", pcr)
+		}
+	}
+	switch t.PCRBank {
+	case "", "sha1", "sha256", "sha384", "sha512":
+	default:
+		return fmt.Errorf("systemd-tpm2: invalid tpm2-pcr-bank %q", t.PCRBank)
+	}
+	switch t.PrimaryAlg {
+	case "", "ecc", "rsa":
+	default:
+		return fmt.Errorf("systemd-tpm2: invalid tpm2-primary-alg %q", t.PrimaryAlg)
+	}
+	if _, err := hex.DecodeString(t.PolicyHash); err != nil {
+		return fmt.Errorf("systemd-tpm2: invalid tpm2-policy-hash: %w", err)
+	}
+	return nil
+}
+
+// SystemdFIDO2Token is a token enrolled by systemd-cryptenroll --fido2-device.
+// Unset flags are interpreted by systemd with their historic defaults.
+type SystemdFIDO2Token struct {
+	Keyslots          KeyslotList `json:"keyslots"`
+	Credential        []byte      `json:"fido2-credential"`
+	Salt              []byte      `json:"fido2-salt"`
+	RelyingParty      string      `json:"fido2-rp,omitempty"`
+	ClientPINRequired *bool       `json:"fido2-clientPin-required,omitempty"`
+	UPRequired        *bool       `json:"fido2-up-required,omitempty"`
+	UVRequired        *bool       `json:"fido2-uv-required,omitempty"`
+
+	UnknownTokenFields
+}
+
+// Type returns "systemd-fido2".
+func (t *SystemdFIDO2Token) Type() string { return "systemd-fido2" }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *SystemdFIDO2Token) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate returns an error if the token definition is malformed.
+func (t *SystemdFIDO2Token) Validate() error {
+	if err := t.Keyslots.validate(); err != nil {
+		return err
+	}
+	if len(t.Credential) == 0 {
+		return errors.New("systemd-fido2: missing fido2-credential")
+	}
+	if len(t.Salt) == 0 {
+		return errors.New("systemd-fido2: missing fido2-salt")
+	}
+	return nil
+}
+
+// SystemdRecoveryToken marks a keyslot holding a recovery key enrolled by systemd-cryptenroll --recovery-key.
+type SystemdRecoveryToken struct {
+	Keyslots KeyslotList `json:"keyslots"`
+
+	UnknownTokenFields
+}
+
+// Type returns "systemd-recovery".
+func (t *SystemdRecoveryToken) Type() string { return "systemd-recovery" }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *SystemdRecoveryToken) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate returns an error if the token definition is malformed.
+func (t *SystemdRecoveryToken) Validate() error {
+	return t.Keyslots.validate()
+}
+
+// SystemdPKCS11Token is a token enrolled by systemd-cryptenroll --pkcs11-token-uri.
+type SystemdPKCS11Token struct {
+	Keyslots KeyslotList `json:"keyslots"`
+	URI      string      `json:"pkcs11-uri"`
+	Key      []byte      `json:"pkcs11-key"`
+
+	UnknownTokenFields
+}
+
+// Type returns "systemd-pkcs11".
+func (t *SystemdPKCS11Token) Type() string { return "systemd-pkcs11" }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *SystemdPKCS11Token) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate returns an error if the token definition is malformed.
+func (t *SystemdPKCS11Token) Validate() error {
+	if err := t.Keyslots.validate(); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(t.URI, "pkcs11:") {
+		return fmt.Errorf("systemd-pkcs11: invalid pkcs11-uri %q", t.URI)
+	}
+	if len(t.Key) == 0 {
+		return errors.New("systemd-pkcs11: missing pkcs11-key")
+	}
+	return nil
+}
+
+// ClevisJWE is the flattened JWE holding the clevis-encrypted passphrase.
+type ClevisJWE struct {
+	Protected    string `json:"protected"`
+	EncryptedKey string `json:"encrypted_key"`
+	IV           string `json:"iv"`
+	Ciphertext   string `json:"ciphertext"`
+	Tag          string `json:"tag"`
+}
+
+// ClevisToken is a token written by clevis luks bind.
+type ClevisToken struct {
+	Keyslots KeyslotList `json:"keyslots"`
+	JWE      ClevisJWE   `json:"jwe"`
+
+	UnknownTokenFields
+}
+
+// Type returns "clevis".
+func (t *ClevisToken) Type() string { return "clevis" }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *ClevisToken) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate returns an error if the token definition is malformed.
+func (t *ClevisToken) Validate() error {
+	if err := t.Keyslots.validate(); err != nil {
+		return err
+	}
+	if t.JWE.Protected == "" || t.JWE.Ciphertext == "" {
+		return errors.New("clevis: incomplete jwe")
+	}
+	return nil
+}
+
+// LUKS2KeyringToken is the builtin token type handled by libcryptsetup.
+type LUKS2KeyringToken struct {
+	Keyslots       KeyslotList `json:"keyslots"`
+	KeyDescription string      `json:"key_description"`
+
+	UnknownTokenFields
+}
+
+// Type returns "luks2-keyring".
+func (t *LUKS2KeyringToken) Type() string { return "luks2-keyring" }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *LUKS2KeyringToken) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate returns an error if the token definition is malformed.
+func (t *LUKS2KeyringToken) Validate() error {
+	if err := t.Keyslots.validate(); err != nil {
+		return err
+	}
+	if t.KeyDescription == "" {
+		return errors.New("luks2-keyring: missing key_description")
+	}
+	return nil
+}
+
+// RawToken holds a token of a type that is not defined with DefineTokenType.
+type RawToken struct {
+	TokenType string
+	Keyslots  KeyslotList
+	JSON      string
+}
+
+// Type returns the type of the token.
+func (t *RawToken) Type() string { return t.TokenType }
+
+// AssignedKeyslots returns the keyslots assigned to the token.
+func (t *RawToken) AssignedKeyslots() []int { return t.Keyslots }
+
+// Validate checks that JSON is a well-formed token definition of type TokenType.
+func (t *RawToken) Validate() error {
+	var header tokenHeader
+	if err := json.Unmarshal([]byte(t.JSON), &header); err != nil {
+		return err
+	}
+	if header.Type != t.TokenType {
+		return fmt.Errorf("token type %q does not match %q", header.Type, t.TokenType)
+	}
+	return nil
+}
+
+type tokenHeader struct {
+	Type     string      `json:"type"`
+	Keyslots KeyslotList `json:"keyslots"`
+}
+
+var tokenTypesMux = sync.RWMutex{}
+
+var tokenTypes = map[string]func() Token{
+	"systemd-tpm2":     func() Token { return &SystemdTPM2Token{} },
+	"systemd-fido2":    func() Token { return &SystemdFIDO2Token{} },
+	"systemd-recovery": func() Token { return &SystemdRecoveryToken{} },
+	"systemd-pkcs11":   func() Token { return &SystemdPKCS11Token{} },
+	"clevis":           func() Token { return &ClevisToken{} },
+	"luks2-keyring":    func() Token { return &LUKS2KeyringToken{} },
+}
+
+// DefineTokenType adds a typed token definition used by ParseToken.
+// newToken must return a pointer to a new, empty token of the given type.
+// Defining an already known type replaces it.
+// Unlike TokenRegister, it does not make libcryptsetup handle tokens of the type.
+func DefineTokenType(tokenType string, newToken func() Token) {
+	tokenTypesMux.Lock()
+	defer tokenTypesMux.Unlock()
+
+	tokenTypes[tokenType] = newToken
+}
+
+// ParseToken decodes and validates a token JSON definition.
+// Fields not declared by a typed token are kept in its UnknownTokenFields, if it embeds them.
+// Tokens of undefined types are returned as *RawToken.
+func ParseToken(tokenJSON string) (Token, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(tokenJSON), &fields); err != nil {
+		return nil, err
+	}
+	var header tokenHeader
+	if err := json.Unmarshal([]byte(tokenJSON), &header); err != nil {
+		return nil, err
+	}
+	if header.Type == "" {
+		return nil, errors.New("token has no type")
+	}
+
+	tokenTypesMux.RLock()
+	newToken, ok := tokenTypes[header.Type]
+	tokenTypesMux.RUnlock()
+	if !ok {
+		return &RawToken{TokenType: header.Type, Keyslots: header.Keyslots, JSON: tokenJSON}, nil
+	}
+
+	token := newToken()
+	if err := json.Unmarshal([]byte(tokenJSON), token); err != nil {
+		return nil, fmt.Errorf("%s: %w", header.Type, err)
+	}
+	if withUnknown, ok := token.(tokenWithUnknownFields); ok {
+		delete(fields, "type")
+		known := map[string]bool{}
+		jsonFieldNames(reflect.TypeOf(token), known)
+		for name := range fields {
+			// encoding/json matches field names case-insensitively.
+			if known[strings.ToLower(name)] {
+				delete(fields, name)
+			}
+		}
+		if len(fields) > 0 {
+			*withUnknown.unknownFields() = fields
+		}
+	}
+	if err := token.Validate(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// jsonFieldNames adds the lower case JSON object keys decoded into a struct type to names.
+func jsonFieldNames(typ reflect.Type, names map[string]bool) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+		case field.Anonymous && name == "":
+			jsonFieldNames(field.Type, names)
+		case !field.IsExported():
+		case name == "":
+			names[strings.ToLower(field.Name)] = true
+		default:
+			names[strings.ToLower(name)] = true
+		}
+	}
+}
+
+// MarshalToken validates a token and encodes it as a LUKS2 token JSON definition.
+func MarshalToken(token Token) (string, error) {
+	if err := token.Validate(); err != nil {
+		return "", err
+	}
+	if raw, ok := token.(*RawToken); ok {
+		return raw.JSON, nil
+	}
+
+	body, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", err
+	}
+	if fields["type"], err = json.Marshal(token.Type()); err != nil {
+		return "", err
+	}
+	if withUnknown, ok := token.(tokenWithUnknownFields); ok {
+		for name, value := range *withUnknown.unknownFields() {
+			if _, ok := fields[name]; !ok {
+				fields[name] = value
+			}
+		}
+	}
+	if _, ok := fields["keyslots"]; !ok || string(fields["keyslots"]) == "null" {
+		fields["keyslots"] = json.RawMessage("[]")
+	}
+
+	res, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(res), nil
+}
+
+// Token gets a typed token definition.
+// Tokens of undefined types are returned as *RawToken.
+func (device *Device) Token(token int) (Token, error) {
+	tokenJSON, err := device.TokenJSONGet(token)
+	if err != nil {
+		return nil, err
+	}
+	return ParseToken(tokenJSON)
+}
+
+// TokenSet validates and stores a typed token definition.
+// Use CRYPT_ANY_TOKEN to allocate new one.
+// Returns allocated token ID on success, or an error otherwise.
+func (device *Device) TokenSet(token int, t Token) (int, error) {
+	tokenJSON, err := MarshalToken(t)
+	if err != nil {
+		return -1, err
+	}
+	return device.TokenJSONSet(token, tokenJSON)
+}
+
+// Tokens returns all active tokens of the device by token ID.
+// Returns an error if any token cannot be parsed.
+func (device *Device) Tokens() (map[int]Token, error) {
+	if err := device.lock(); err != nil {
+		return nil, err
+	}
+	defer device.mux.Unlock()
+
+	tokenMax, err := TokenMax(CRYPT_LUKS2)
+	if err != nil {
+		tokenMax = luks2TokensMax
+	}
+
+	tokens := make(map[int]Token)
+	for id := 0; id < tokenMax; id++ {
+		if _, status := device.tokenStatus(id); status == CRYPT_TOKEN_INVALID || status == CRYPT_TOKEN_INACTIVE {
+			continue
+		}
+		tokenJSON, err := device.tokenJSONGet(id)
+		if err != nil {
+			return nil, fmt.Errorf("token %d: %w", id, err)
+		}
+		token, err := ParseToken(tokenJSON)
+		if err != nil {
+			return nil, fmt.Errorf("token %d: %w", id, err)
+		}
+		tokens[id] = token
+	}
+	return tokens, nil
+}
+
+// luks2TokensMax is the number of LUKS2 tokens, used if crypt_token_max is not available.
+const luks2TokensMax = 32
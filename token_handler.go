@@ -0,0 +1,113 @@
+package cryptsetup
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/libc"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// TokenHandler is implemented by Go token types that can be registered with TokenRegister.
+// Once registered, tokens of this type can be used by ActivateByToken and
+// are reported by TokenStatus as CRYPT_TOKEN_EXTERNAL.
+type TokenHandler interface {
+	// Name returns the token type. The "luks2-" prefix is reserved by libcryptsetup.
+	Name() string
+	// Open returns the passphrase unlocking the keyslots assigned to the token.
+	// tokenJSON is the JSON definition of the token as stored in the LUKS2 header.
+	// The returned slice is zeroed after it has been handed to libcryptsetup.
+	Open(token int, tokenJSON string) ([]byte, error)
+	// Validate checks a token JSON definition before it is stored in the LUKS2 header.
+	Validate(tokenJSON string) error
+	// Dump returns type-specific information printed by Dump.
+	// It is written to the log of libcryptsetup at level CRYPT_LOG_NORMAL, like the rest of the dump.
+	Dump(tokenJSON string) string
+}
+
+var tokenHandlersMux = sync.Mutex{}
+
+var tokenHandlers = map[string]TokenHandler{}
+
+// TokenRegister registers a token handler with libcryptsetup.
+// Handlers are global to the process and cannot be unregistered.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_token_register
+func TokenRegister(handler TokenHandler) error {
+	if err := ensureIntialized(); err != nil {
+		return err
+	}
+
+	tokenHandlersMux.Lock()
+	defer tokenHandlersMux.Unlock()
+
+	name := handler.Name()
+	if _, ok := tokenHandlers[name]; ok {
+		return fmt.Errorf("token handler %q is already registered", name)
+	}
+
+	// libcryptsetup keeps a reference to the handler, so it is never freed.
+	cHandler := (*crypt.TokenHandler)(libc.Malloc(uint64(crypt.SizeofTokenHandler)))
+	cHandler.Name = strings.CString(name)
+	cHandler.Open = crypt.NewCallback(func(cd *crypt.CryptDevice, token int32, buffer **byte, bufferLen *uint64, usrptr unsafe.Pointer) int32 {
+		return tokenOpenCallback(handler, cd, token, buffer, bufferLen)
+	})
+	cHandler.BufferFree = crypt.NewCallback(tokenBufferFreeCallback)
+	cHandler.Validate = crypt.NewCallback(func(cd *crypt.CryptDevice, json *byte) int32 {
+		if err := handler.Validate(strings.GoString(json)); err != nil {
+			return tokenErrorCode(err)
+		}
+		return 0
+	})
+	cHandler.Dump = crypt.NewCallback(func(cd *crypt.CryptDevice, json *byte) {
+		if dump := handler.Dump(strings.GoString(json)); dump != "" {
+			cDump := strings.CString(dump + "\n")
+			defer strings.CFree(cDump)
+			crypt.Log(cd, CRYPT_LOG_NORMAL, cDump)
+		}
+	})
+
+	if res := crypt.TokenRegister(cHandler); res < 0 {
+		return &Error{functionName: "crypt_token_register", code: int(res)}
+	}
+
+	tokenHandlers[name] = handler
+	return nil
+}
+
+func tokenOpenCallback(handler TokenHandler, cd *crypt.CryptDevice, token int32, buffer **byte, bufferLen *uint64) int32 {
+	var cJSON *byte
+	if res := crypt.TokenJSONGet(cd, uint32(token), &cJSON); res < 0 {
+		return res
+	}
+
+	passphrase, err := handler.Open(int(token), strings.GoString(cJSON))
+	if err != nil {
+		return tokenErrorCode(err)
+	}
+
+	*buffer = strings.CSecret(passphrase)
+	*bufferLen = uint64(len(passphrase))
+	WipeSecret(passphrase)
+	if *buffer == nil {
+		return -12 // ENOMEM
+	}
+	return 0
+}
+
+func tokenBufferFreeCallback(buffer unsafe.Pointer, bufferLen uint64) {
+	strings.SecretFree(buffer)
+}
+
+// tokenErrorCode converts an error returned by a TokenHandler to a negative errno value.
+// Errors implementing Code() int, like Error, are passed on to libcryptsetup as is.
+func tokenErrorCode(err error) int32 {
+	var codeErr interface{ Code() int }
+	if errors.As(err, &codeErr) && codeErr.Code() < 0 {
+		return int32(codeErr.Code())
+	}
+	return -22 // EINVAL
+}
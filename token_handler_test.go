@@ -0,0 +1,126 @@
+package cryptsetup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// keyServiceToken is a reference TokenHandler that keeps the passphrase in the token itself.
+// A real implementation would use the token JSON to fetch the passphrase from a key service.
+type keyServiceToken struct{}
+
+type keyServiceTokenJSON struct {
+	Type       string   `json:"type"`
+	Keyslots   []string `json:"keyslots"`
+	Passphrase string   `json:"passphrase"`
+}
+
+func (keyServiceToken) Name() string {
+	return "go-key-service"
+}
+
+func (keyServiceToken) Open(token int, tokenJSON string) ([]byte, error) {
+	var t keyServiceTokenJSON
+	if err := json.Unmarshal([]byte(tokenJSON), &t); err != nil {
+		return nil, err
+	}
+	return []byte(t.Passphrase), nil
+}
+
+func (keyServiceToken) Validate(tokenJSON string) error {
+	var t keyServiceTokenJSON
+	if err := json.Unmarshal([]byte(tokenJSON), &t); err != nil {
+		return err
+	}
+	if t.Passphrase == "" {
+		return errors.New("missing passphrase")
+	}
+	return nil
+}
+
+func (keyServiceToken) Dump(tokenJSON string) string {
+	return "\tkey service token"
+}
+
+var (
+	registerKeyServiceTokenOnce sync.Once
+	registerKeyServiceTokenErr  error
+)
+
+func registerKeyServiceToken() error {
+	registerKeyServiceTokenOnce.Do(func() {
+		registerKeyServiceTokenErr = TokenRegister(keyServiceToken{})
+	})
+	return registerKeyServiceTokenErr
+}
+
+func Test_TokenRegister_Fails_If_Registered_Twice(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	testWrapper.AssertNoError(registerKeyServiceToken())
+	testWrapper.AssertError(TokenRegister(keyServiceToken{}))
+}
+
+func Test_Device_ActivateByToken_Using_Registered_Handler(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	testWrapper.AssertNoError(registerKeyServiceToken())
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "tokenPassphrase")
+	testWrapper.AssertNoError(err)
+
+	tokenID, err := device.TokenJSONSet(CRYPT_ANY_TOKEN, `{"type":"go-key-service","keyslots":["0"],"passphrase":"tokenPassphrase"}`)
+	testWrapper.AssertNoError(err)
+
+	tokenType, status := device.TokenStatus(tokenID)
+	if tokenType != "go-key-service" {
+		test.Errorf("Expected token type to be go-key-service, got %s", tokenType)
+	}
+	if status != CRYPT_TOKEN_EXTERNAL {
+		test.Errorf("Expected token status to be %d, got %d", CRYPT_TOKEN_EXTERNAL, status)
+	}
+
+	err = device.ActivateByToken("", tokenID, "", 0)
+	testWrapper.AssertNoError(err)
+
+	keyslot, err := device.ActivateByTokenKeyslot("", CRYPT_ANY_TOKEN, nil, 0)
+	testWrapper.AssertNoError(err)
+	if keyslot != 0 {
+		test.Errorf("Expected keyslot 0 to be unlocked, got %d", keyslot)
+	}
+
+	// Binary user data is passed through as is.
+	_, err = device.ActivateByTokenKeyslot("", CRYPT_ANY_TOKEN, []byte{0x00, 0xff, 0x00}, 0)
+	testWrapper.AssertNoError(err)
+
+	_, err = device.TokenJSONSet(tokenID, `{"type":"go-key-service","keyslots":["0"],"passphrase":"wrongPassphrase"}`)
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateByToken("", tokenID, "", 0)
+	testWrapper.AssertError(err)
+}
+
+func Test_Device_TokenJSONSet_Fails_If_Registered_Handler_Rejects_Token(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	testWrapper.AssertNoError(registerKeyServiceToken())
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	_, err = device.TokenJSONSet(CRYPT_ANY_TOKEN, fmt.Sprintf(`{"type":%q,"keyslots":[]}`, keyServiceToken{}.Name()))
+	testWrapper.AssertError(err)
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
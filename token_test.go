@@ -0,0 +1,130 @@
+package cryptsetup
+
+import (
+	"testing"
+)
+
+const systemdTPM2TokenJSON = `{"type":"systemd-tpm2","keyslots":["1"],"tpm2-blob":"AJ4AIA==","tpm2-pcrs":[7],"tpm2-pcr-bank":"sha256","tpm2-primary-alg":"ecc","tpm2-policy-hash":"c6ba2ab1","tpm2-pin":false}`
+
+func Test_ParseToken_SystemdTPM2(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	token, err := ParseToken(systemdTPM2TokenJSON)
+	testWrapper.AssertNoError(err)
+
+	tpm2, ok := token.(*SystemdTPM2Token)
+	if !ok {
+		test.Fatalf("Expected *SystemdTPM2Token, got %T", token)
+	}
+	if len(tpm2.Keyslots) != 1 || tpm2.Keyslots[0] != 1 {
+		test.Errorf("Expected keyslots [1], got %v", tpm2.Keyslots)
+	}
+	if len(tpm2.Blob) != 4 {
+		test.Errorf("Expected blob of 4 bytes, got %d", len(tpm2.Blob))
+	}
+
+	out, err := MarshalToken(tpm2)
+	testWrapper.AssertNoError(err)
+	roundTrip, err := ParseToken(out)
+	testWrapper.AssertNoError(err)
+	if roundTrip.(*SystemdTPM2Token).PolicyHash != tpm2.PolicyHash {
+		test.Errorf("Round trip changed the token: %s", out)
+	}
+}
+
+func Test_ParseToken_Rejects_Malformed_Tokens(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	for _, tokenJSON := range []string{
+		`{"keyslots":[]}`,
+		`{"type":"systemd-recovery","keyslots":["one"]}`,
+		`{"type":"systemd-tpm2","keyslots":["1"],"tpm2-blob":"AJ4AIA==","tpm2-pcrs":[42],"tpm2-policy-hash":""}`,
+		`{"type":"systemd-fido2","keyslots":["1"],"fido2-credential":"AJ4AIA=="}`,
+		`{"type":"systemd-pkcs11","keyslots":["1"],"pkcs11-uri":"file:///key","pkcs11-key":"AJ4AIA=="}`,
+		`{"type":"clevis","keyslots":["1"],"jwe":{}}`,
+	} {
+		_, err := ParseToken(tokenJSON)
+		testWrapper.AssertError(err)
+	}
+}
+
+func Test_ParseToken_Keeps_Unknown_Fields(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	token, err := ParseToken(`{"type":"systemd-recovery","keyslots":["2"],"recovery-hint":{"created":"2026"}}`)
+	testWrapper.AssertNoError(err)
+
+	recovery, ok := token.(*SystemdRecoveryToken)
+	if !ok {
+		test.Fatalf("Expected *SystemdRecoveryToken, got %T", token)
+	}
+	if len(recovery.Unknown) != 1 || string(recovery.Unknown["recovery-hint"]) != `{"created":"2026"}` {
+		test.Errorf("Expected the unknown field to be kept, got %q", recovery.Unknown)
+	}
+
+	out, err := MarshalToken(recovery)
+	testWrapper.AssertNoError(err)
+	if out != `{"keyslots":["2"],"recovery-hint":{"created":"2026"},"type":"systemd-recovery"}` {
+		test.Errorf("Expected the unknown field to be written back, got %s", out)
+	}
+
+	// Declared fields are not reported as unknown.
+	token, err = ParseToken(systemdTPM2TokenJSON)
+	testWrapper.AssertNoError(err)
+	if unknown := token.(*SystemdTPM2Token).Unknown; len(unknown) != 0 {
+		test.Errorf("Expected no unknown fields, got %q", unknown)
+	}
+}
+
+func Test_ParseToken_Returns_RawToken_For_Unknown_Types(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	token, err := ParseToken(`{"type":"unit-test","keyslots":["0"],"data":"foo"}`)
+	testWrapper.AssertNoError(err)
+
+	raw, ok := token.(*RawToken)
+	if !ok {
+		test.Fatalf("Expected *RawToken, got %T", token)
+	}
+	if raw.Type() != "unit-test" || len(raw.AssignedKeyslots()) != 1 {
+		test.Errorf("Unexpected raw token: %+v", raw)
+	}
+}
+
+func Test_Device_Tokens(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+
+	err = device.Format(LUKS2{SectorSize: 512}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 512 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.KeyslotAddByVolumeKey(0, "", "testPassphrase")
+	testWrapper.AssertNoError(err)
+
+	_, err = device.TokenSet(CRYPT_ANY_TOKEN, &SystemdFIDO2Token{Keyslots: KeyslotList{0}})
+	testWrapper.AssertError(err) // missing credential and salt
+
+	recoveryID, err := device.TokenSet(CRYPT_ANY_TOKEN, &SystemdRecoveryToken{Keyslots: KeyslotList{0}})
+	testWrapper.AssertNoError(err)
+
+	tpm2Token, err := ParseToken(systemdTPM2TokenJSON)
+	testWrapper.AssertNoError(err)
+	tpm2Token.(*SystemdTPM2Token).Keyslots = KeyslotList{0}
+	tpm2ID, err := device.TokenSet(CRYPT_ANY_TOKEN, tpm2Token)
+	testWrapper.AssertNoError(err)
+
+	tokens, err := device.Tokens()
+	testWrapper.AssertNoError(err)
+	if len(tokens) != 2 {
+		test.Fatalf("Expected 2 tokens, got %d", len(tokens))
+	}
+	if _, ok := tokens[recoveryID].(*SystemdRecoveryToken); !ok {
+		test.Errorf("Expected *SystemdRecoveryToken, got %T", tokens[recoveryID])
+	}
+	if _, ok := tokens[tpm2ID].(*SystemdTPM2Token); !ok {
+		test.Errorf("Expected *SystemdTPM2Token, got %T", tokens[tpm2ID])
+	}
+}
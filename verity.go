@@ -0,0 +1,119 @@
+package cryptsetup
+
+import (
+	"unsafe"
+
+	"github.com/malt3/purego-cryptsetup/internal/dlopen/crypt"
+	"github.com/malt3/purego-cryptsetup/internal/strings"
+)
+
+// Verity is the struct used to manipulate dm-verity devices.
+// The crypt device is the hash device; DataDevice holds the verified data.
+type Verity struct {
+	HashName   string
+	DataDevice string
+	HashDevice string
+	FECDevice  string
+	Salt       []byte
+	// HashType is 1 for normal and 0 for the legacy Chrome OS format.
+	HashType      uint32
+	DataBlockSize uint32
+	HashBlockSize uint32
+	// DataSize is the size of the data area in data blocks.
+	DataSize uint64
+	// HashAreaOffset is the offset of the hash area on the hash device in bytes.
+	HashAreaOffset uint64
+	FECAreaOffset  uint64
+	FECRoots       uint32
+	// Flags is a combination of CRYPT_VERITY_* flags.
+	Flags uint32
+}
+
+// Name returns the VERITY device type name as a string.
+func (verity Verity) Name() string {
+	return CRYPT_VERITY
+}
+
+// Unmanaged is used to specialize Verity.
+func (verity Verity) Unmanaged() (unsafe.Pointer, func()) {
+	deallocations := make([]func(), 0)
+	deallocate := func() {
+		for index := 0; index < len(deallocations); index++ {
+			deallocations[index]()
+		}
+	}
+
+	var cParams crypt.ParamsVerity
+
+	cString := func(value string) *byte {
+		if value == "" {
+			return nil
+		}
+		cValue := strings.CString(value)
+		deallocations = append(deallocations, func() {
+			strings.CFree(cValue)
+		})
+		return cValue
+	}
+	cParams.HashName = cString(verity.HashName)
+	cParams.DataDevice = cString(verity.DataDevice)
+	cParams.HashDevice = cString(verity.HashDevice)
+	cParams.FECDevice = cString(verity.FECDevice)
+	cParams.Salt = cString(string(verity.Salt))
+	cParams.SaltSize = uint32(len(verity.Salt))
+
+	cParams.HashType = verity.HashType
+	cParams.DataBlockSize = verity.DataBlockSize
+	cParams.HashBlockSize = verity.HashBlockSize
+	cParams.DataSize = verity.DataSize
+	cParams.HashAreaOffset = verity.HashAreaOffset
+	cParams.FECAreaOffset = verity.FECAreaOffset
+	cParams.FECRoots = verity.FECRoots
+	cParams.Flags = verity.Flags
+
+	return unsafe.Pointer(&cParams), deallocate
+}
+
+// ActivateBySignedKey activates a dm-verity device using its root hash and a detached PKCS#7 signature of it,
+// which the kernel verifies against its trusted keyrings, see SignRootHash.
+// If deviceName is empty, only the root hash is checked, against the hash tree if the device was loaded with CRYPT_VERITY_CHECK_HASH;
+// a signature requires a deviceName.
+// Returns nil on success, or an error otherwise.
+// C equivalent: crypt_activate_by_signed_key
+func (device *Device) ActivateBySignedKey(deviceName string, rootHash []byte, signature []byte, flags ActivateFlags) error {
+	if err := device.lock(); err != nil {
+		return err
+	}
+	defer device.mux.Unlock()
+
+	if err := supported("crypt_activate_by_signed_key"); err != nil {
+		return err
+	}
+	if err := device.validateActivateFlags(flags); err != nil {
+		return err
+	}
+
+	var cDeviceName *byte
+	if deviceName != "" {
+		cDeviceName = strings.CString(deviceName)
+		defer strings.CFree(cDeviceName)
+	}
+
+	var cRootHash *byte
+	if len(rootHash) > 0 {
+		cRootHash = strings.CString(string(rootHash))
+		defer strings.CFree(cRootHash)
+	}
+
+	var cSignature *byte
+	if len(signature) > 0 {
+		cSignature = strings.CString(string(signature))
+		defer strings.CFree(cSignature)
+	}
+
+	res := crypt.ActivateBySignedKey(device.cryptDevice, cDeviceName, cRootHash, uint64(len(rootHash)), cSignature, uint64(len(signature)), uint32(flags))
+	if res < 0 {
+		return &Error{functionName: "crypt_activate_by_signed_key", code: int(res)}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package cryptsetup
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidSHA256     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// pkcs7ContentInfo is the PKCS#7 ContentInfo of RFC 2315, section 7.
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     pkcs7SignedData `asn1:"explicit,tag:0"`
+}
+
+// pkcs7SignedData is the PKCS#7 SignedData of RFC 2315, section 9.1, without content and certificates.
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+// pkcs7SignerInfo is the PKCS#7 SignerInfo of RFC 2315, section 9.2, without authenticated attributes.
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7IssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// SignRootHash creates the detached PKCS#7 signature of a dm-verity root hash expected by ActivateBySignedKey,
+// like `openssl smime -sign -nocerts -noattr -binary -outform der` of the hexadecimal root hash.
+// The signature is made with SHA-256 by key, an RSA or ECDSA key matching certificate.
+// The kernel only accepts it if certificate is in its builtin or secondary trusted keyring.
+// Returns the DER encoded signature on success, or an error otherwise.
+func SignRootHash(rootHash []byte, certificate *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	if len(rootHash) == 0 {
+		return nil, fmt.Errorf("root hash is empty")
+	}
+
+	if public, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !public.Equal(certificate.PublicKey) {
+		return nil, fmt.Errorf("signing key does not match certificate")
+	}
+
+	var signatureAlgorithm pkix.AlgorithmIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSA, Parameters: asn1.NullRawValue}
+	case *ecdsa.PublicKey:
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidECDSA}
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key.Public())
+	}
+
+	// The kernel verifies the signature of the root hash as passed in the dm-verity table.
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(hex.EncodeToString(rootHash)))
+	signature, err := key.Sign(rand.Reader, digest.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("signing root hash: %w", err)
+	}
+
+	digestAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	signedData := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		SignerInfos: []pkcs7SignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: pkcs7IssuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: certificate.RawIssuer},
+				SerialNumber: certificate.SerialNumber,
+			},
+			DigestAlgorithm:           digestAlgorithm,
+			DigestEncryptionAlgorithm: signatureAlgorithm,
+			EncryptedDigest:           signature,
+		}},
+	}
+	signedData.ContentInfo.ContentType = oidData
+
+	return asn1.Marshal(pkcs7ContentInfo{ContentType: oidSignedData, Content: signedData})
+}
@@ -0,0 +1,89 @@
+package cryptsetup
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func rsaSigningKey(test *testing.T) crypto.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return key
+}
+
+func generateSigningCertificate(test *testing.T, key crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "verity signing key"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		test.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return certificate, key
+}
+
+func Test_SignRootHash(test *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		key       crypto.Signer
+		algorithm x509.SignatureAlgorithm
+	}{
+		"rsa":   {key: rsaSigningKey(test), algorithm: x509.SHA256WithRSA},
+		"ecdsa": {key: ecdsaKey, algorithm: x509.ECDSAWithSHA256},
+	} {
+		test.Run(name, func(test *testing.T) {
+			testWrapper := TestWrapper{test}
+			certificate, key := generateSigningCertificate(test, tc.key)
+			rootHash := []byte{0xde, 0xad, 0xbe, 0xef}
+
+			signature, err := SignRootHash(rootHash, certificate, key)
+			testWrapper.AssertNoError(err)
+
+			var contentInfo pkcs7ContentInfo
+			rest, err := asn1.Unmarshal(signature, &contentInfo)
+			testWrapper.AssertNoError(err)
+			if len(rest) != 0 || !contentInfo.ContentType.Equal(oidSignedData) || len(contentInfo.Content.SignerInfos) != 1 {
+				test.Fatalf("Unexpected PKCS#7 structure %+v", contentInfo)
+			}
+			signerInfo := contentInfo.Content.SignerInfos[0]
+			if signerInfo.IssuerAndSerialNumber.SerialNumber.Cmp(certificate.SerialNumber) != 0 {
+				test.Errorf("Unexpected serial number %v", signerInfo.IssuerAndSerialNumber.SerialNumber)
+			}
+			err = certificate.CheckSignature(tc.algorithm, []byte(hex.EncodeToString(rootHash)), signerInfo.EncryptedDigest)
+			testWrapper.AssertNoError(err)
+		})
+	}
+}
+
+func Test_SignRootHash_Fails_With_Mismatching_Key(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	certificate, _ := generateSigningCertificate(test, rsaSigningKey(test))
+
+	_, err := SignRootHash([]byte{1}, certificate, rsaSigningKey(test))
+	testWrapper.AssertError(err)
+	_, err = SignRootHash(nil, certificate, rsaSigningKey(test))
+	testWrapper.AssertError(err)
+}
@@ -0,0 +1,95 @@
+package cryptsetup
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// formatVerity creates a dm-verity hash tree of DevicePath in a separate hash file and returns the hash device and its root hash.
+func formatVerity(test *testing.T) (*Device, []byte) {
+	testWrapper := TestWrapper{test}
+
+	hashPath := DevicePath + ".hash"
+	if err := os.WriteFile(hashPath, make([]byte, 1<<20), 0o600); err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { os.Remove(hashPath) })
+
+	device, err := Init(hashPath)
+	testWrapper.AssertNoError(err)
+	test.Cleanup(func() { device.Free() })
+
+	err = device.Format(Verity{
+		HashName:      "sha256",
+		DataDevice:    DevicePath,
+		Salt:          []byte("salt"),
+		HashType:      1,
+		DataBlockSize: 4096,
+		HashBlockSize: 4096,
+		DataSize:      (64 << 20) / 4096,
+		Flags:         CRYPT_VERITY_CREATE_HASH,
+	}, GenericParams{})
+	testWrapper.AssertNoError(err)
+
+	rootHash, _, err := device.VolumeKeyGetBytes(CRYPT_ANY_SLOT, nil)
+	testWrapper.AssertNoError(err)
+	if len(rootHash) != 32 {
+		test.Fatalf("Expected a 32 byte root hash, got %d bytes", len(rootHash))
+	}
+	return device, rootHash
+}
+
+func Test_Device_ActivateBySignedKey_Checks_Root_Hash(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	device, rootHash := formatVerity(test)
+	if device.Type() != CRYPT_VERITY {
+		test.Errorf("Expected type %s, got %s", CRYPT_VERITY, device.Type())
+	}
+
+	// The hash tree is only verified in userspace if requested when loading the device.
+	loaded, err := Init(DevicePath + ".hash")
+	testWrapper.AssertNoError(err)
+	defer loaded.Free()
+	err = loaded.Load(Verity{DataDevice: DevicePath, Flags: CRYPT_VERITY_CHECK_HASH})
+	testWrapper.AssertNoError(err)
+
+	err = loaded.ActivateBySignedKey("", rootHash, nil, CRYPT_ACTIVATE_READONLY)
+	if errors.Is(err, ErrNotSupported) {
+		test.Skip(err)
+	}
+	testWrapper.AssertNoError(err)
+
+	wrongRootHash := append([]byte{}, rootHash...)
+	wrongRootHash[0] ^= 0xff
+	err = loaded.ActivateBySignedKey("", wrongRootHash, nil, CRYPT_ACTIVATE_READONLY)
+	testWrapper.AssertError(err)
+}
+
+func Test_Device_ActivateBySignedKey_Requires_Name_For_Signature(test *testing.T) {
+	testWrapper := TestWrapper{test}
+	device, rootHash := formatVerity(test)
+
+	certificate, key := generateSigningCertificate(test, rsaSigningKey(test))
+	signature, err := SignRootHash(rootHash, certificate, key)
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateBySignedKey("", rootHash, signature, CRYPT_ACTIVATE_READONLY)
+	if errors.Is(err, ErrNotSupported) {
+		test.Skip(err)
+	}
+	testWrapper.AssertErrorCodeEquals(err, -22)
+}
+
+func Test_Device_ActivateBySignedKey_Fails_Without_Verity(test *testing.T) {
+	testWrapper := TestWrapper{test}
+
+	device, err := Init(DevicePath)
+	testWrapper.AssertNoError(err)
+	defer device.Free()
+	err = device.Format(LUKS1{Hash: "sha256"}, GenericParams{Cipher: "aes", CipherMode: "xts-plain64", VolumeKeySize: 256 / 8})
+	testWrapper.AssertNoError(err)
+
+	err = device.ActivateBySignedKey("", make([]byte, 32), nil, 0)
+	testWrapper.AssertError(err)
+}